@@ -2,33 +2,50 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
 	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/controllers"
 	"github.com/nais/babylon/pkg/criteria"
+	"github.com/nais/babylon/pkg/deployment"
+	"github.com/nais/babylon/pkg/events"
 	"github.com/nais/babylon/pkg/logger"
 	"github.com/nais/babylon/pkg/metrics"
+	"github.com/nais/babylon/pkg/policy"
 	"github.com/nais/babylon/pkg/service"
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	nais_io_v1alpha1 "github.com/nais/liberator/pkg/apis/nais.io/v1alpha1"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	ctrlMetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
+var errNotLeader = errors.New("not leader")
+
 //nolint:funlen
 func main() {
 	logger.Setup(config.GetEnv("LOG_LEVEL", "debug"))
 	cfg := config.ParseConfig()
 
-	// TODO: perhaps timeout between each tick?
-	ctx := context.Background()
+	// cancelled on SIGTERM, after which in-flight cleanups are given SHUTDOWN_TIMEOUT to finish
+	ctx := ctrl.SetupSignalHandler()
 
 	port, err := strconv.Atoi(cfg.Port)
 	if err != nil {
@@ -38,11 +55,24 @@ func main() {
 	scheme := runtime.NewScheme()
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = nais_io_v1.AddToScheme(scheme)
+	_ = nais_io_v1alpha1.AddToScheme(scheme)
+	_ = babylon_nais_io_v1alpha1.AddToScheme(scheme)
+
+	// throttles all requests to the API server, while JUDGE_RATE_LIMIT only limits the workloads judged
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.QPS, restConfig.Burst = cfg.APIQPS, cfg.APIBurst
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
-		MetricsBindAddress:     fmt.Sprintf(":%d", port),
+		Metrics:                metricsserver.Options{BindAddress: fmt.Sprintf(":%d", port)},
 		HealthProbeBindAddress: fmt.Sprintf(":%d", port+1),
+		LeaderElection:         cfg.LeaderElection,
+		LeaderElectionID:       cfg.LeaderElectionID,
+		// LeaderElectionNamespace defaults to the namespace babylon is running in when empty
+		LeaderElectionNamespace:       cfg.LeaderElectionNamespace,
+		LeaderElectionResourceLock:    resourcelock.LeasesResourceLock,
+		LeaderElectionReleaseOnCancel: true,
+		GracefulShutdownTimeout:       &cfg.ShutdownTimeout,
 	})
 	if err != nil {
 		log.Fatalf("error creating manager: %v", err)
@@ -80,34 +110,192 @@ func main() {
 
 	m := metrics.Init(unleash, c)
 	ctrlMetrics.Registry.MustRegister(m.RuleActivations, m.DeploymentCleanup, m.DeploymentGraceCutoff,
-		m.DeploymentUpdated, m.DeploymentStatusTotal, m.SlackChannelMapping)
+		m.DeploymentUpdated, m.DeploymentStatusTotal, m.SlackChannelMapping, m.FailingPodRatio, m.Leader, m.Ticks,
+		m.EvaluationDuration)
+
+	err = deployment.IndexOwners(ctx, mgr.GetFieldIndexer())
+	if err != nil {
+		log.Fatalf("error indexing owners: %v", err)
+	}
+
+	watcher := events.NewWatcher(cfg.EventReasons, cfg.EventMaxAge)
+	informer, err := mgr.GetCache().GetInformer(ctx, &v1.Event{})
+	if err != nil {
+		log.Fatalf("error creating event informer: %v", err)
+	}
+	_, err = informer.AddEventHandler(watcher)
+	if err != nil {
+		log.Fatalf("error adding event handler: %v", err)
+	}
+
+	// policy status is informational, and updated even when not armed
+	policies := policy.NewStore(mgr.GetClient())
+	informer, err = mgr.GetCache().GetInformer(ctx, &babylon_nais_io_v1alpha1.BabylonPolicy{})
+	if err != nil {
+		log.Fatalf("error creating policy informer: %v", err)
+	}
+	_, err = informer.AddEventHandler(policies)
+	if err != nil {
+		log.Fatalf("error adding policy handler: %v", err)
+	}
 
 	h := metrics.NewHistory(influxC, cfg.InfluxdbDatabase, cfg.Cluster)
-	s := service.Service{Config: &cfg, Client: c, Metrics: &m, UnleashClient: unleash, InfluxClient: influxC, History: h}
+	s := service.Service{
+		Config: &cfg, Client: c, Metrics: &m, UnleashClient: unleash, InfluxClient: influxC, History: h, Events: watcher,
+		Policies: policies,
+	}
 
-	go gardener(ctx, &s)
+	coreCriteriaJudge := criteria.NewCoreCriteriaJudge(s.Config, s.Client, s.Metrics, s.History,
+		s.UnleashClient, s.Config.Armed).WithPolicies(s.Policies)
+	coreCriteriaJudge.Rules().Register(criteria.NewEventRules(s.Events, s.Config.EventThreshold)...)
+	cleanUpJudge := criteria.NewCleanUpJudge(s.Config).WithPolicies(s.Policies)
+	executioner := criteria.NewExecutioner(s.Config, s.Client, s.Metrics, s.History).WithPolicies(s.Policies)
+
+	reconciler := &controllers.DeploymentReconciler{
+		Client: s.Client, Judge: coreCriteriaJudge.OnChange(), CleanUp: cleanUpJudge, Executioner: executioner,
+	}
+	err = reconciler.SetupWithManager(mgr)
+	if err != nil {
+		log.Fatalf("error creating deployment controller: %v", err)
+	}
+
+	// the gardener remains as a periodic resync of everything, and is the only judge of statefulsets and cronjobs.
+	// Like the reconciler it only runs while leader.
+	err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		gardener(ctx, &s, coreCriteriaJudge, cleanUpJudge, executioner)
 
-	log.Fatal(mgr.Start(ctx))
+		return nil
+	}))
+	if err != nil {
+		log.Fatalf("error adding gardener: %v", err)
+	}
+
+	var leader int32
+	go func() {
+		<-mgr.Elected()
+		atomic.StoreInt32(&leader, 1)
+		m.Leader.Set(1)
+		log.Info("Elected leader")
+	}()
+	err = addHealthChecks(mgr, &leader)
+	if err != nil {
+		log.Fatalf("error adding health checks: %v", err)
+	}
+
+	err = mgr.Start(ctx)
+	if err != nil {
+		log.Fatalf("error running manager: %v", err)
+	}
+	influxC.Close()
+	log.Info("stopped")
 }
 
-func gardener(ctx context.Context, s *service.Service) {
+func gardener(
+	ctx context.Context,
+	s *service.Service,
+	coreCriteriaJudge *criteria.CoreCriteriaJudge,
+	cleanUpJudge *criteria.CleanUpJudge,
+	executioner *criteria.Executioner) {
 	log.Info("starting gardener")
-	ticker := time.Tick(s.Config.TickRate)
-	coreCriteriaJudge := criteria.NewCoreCriteriaJudge(s.Config, s.Client, s.Metrics, s.History,
-		s.UnleashClient, s.Config.Armed)
-	cleanUpJudge := criteria.NewCleanUpJudge(s.Config)
-	executioner := criteria.NewExecutioner(s.Config, s.Client, s.Metrics, s.History)
+	ticker := time.NewTicker(s.Config.TickRate)
+	defer ticker.Stop()
 
 	for {
-		<-ticker
-		deployments := &appsv1.DeploymentList{}
-		err := s.Client.List(ctx, deployments)
-		if logger.Logk8sError(err) {
-			continue
+		select {
+		case <-ctx.Done():
+			log.Info("stopping gardener")
+
+			return
+		case <-ticker.C:
+		}
+
+		tickCtx, cancel := context.WithTimeout(ctx, s.Config.TickTimeout)
+		tick(tickCtx, s, coreCriteriaJudge, cleanUpJudge, executioner)
+		cancel()
+
+		outcome := metrics.TickCompleted
+		switch {
+		case ctx.Err() != nil:
+			outcome = metrics.TickCancelled
+		case errors.Is(tickCtx.Err(), context.DeadlineExceeded):
+			outcome = metrics.TickTimedOut
+			log.Warnf("Tick did not complete within %v", s.Config.TickTimeout)
 		}
+		s.Metrics.Ticks.WithLabelValues(outcome).Inc()
+	}
+}
+
+// tick judges and cleans up all workloads once, it stops early if the context is done.
+func tick(
+	ctx context.Context,
+	s *service.Service,
+	coreCriteriaJudge *criteria.CoreCriteriaJudge,
+	cleanUpJudge *criteria.CleanUpJudge,
+	executioner *criteria.Executioner) {
+	err := s.Policies.Refresh(ctx)
+	if err != nil {
+		log.Errorf("Could not refresh policies: %v", err)
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	err = s.Client.List(ctx, deployments)
+	if logger.Logk8sError(err) {
+		return
+	}
 
-		fails := coreCriteriaJudge.Failing(ctx, deployments)
-		deploymentFails := cleanUpJudge.Judge(fails)
-		executioner.Kill(ctx, deploymentFails)
+	executioner.RestoreAutoscalers(ctx, deployments.Items)
+
+	start := time.Now()
+	fails := coreCriteriaJudge.Failing(ctx, deployments)
+	s.Metrics.EvaluationDuration.WithLabelValues("deployments").Observe(time.Since(start).Seconds())
+	deploymentFails := cleanUpJudge.Judge(fails)
+	executioner.Kill(ctx, deploymentFails)
+
+	statefulSets := &appsv1.StatefulSetList{}
+	err = s.Client.List(ctx, statefulSets)
+	if logger.Logk8sError(err) {
+		return
 	}
+
+	start = time.Now()
+	failingStatefulSets := coreCriteriaJudge.FailingStatefulSets(ctx, statefulSets)
+	s.Metrics.EvaluationDuration.WithLabelValues("statefulsets").Observe(time.Since(start).Seconds())
+	statefulSetFails := cleanUpJudge.JudgeStatefulSets(failingStatefulSets)
+	executioner.KillStatefulSets(ctx, statefulSetFails)
+
+	cronJobs := &batchv1.CronJobList{}
+	err = s.Client.List(ctx, cronJobs)
+	if logger.Logk8sError(err) {
+		return
+	}
+
+	start = time.Now()
+	failingCronJobs := coreCriteriaJudge.FailingCronJobs(ctx, cronJobs)
+	s.Metrics.EvaluationDuration.WithLabelValues("cronjobs").Observe(time.Since(start).Seconds())
+	cronJobFails := cleanUpJudge.JudgeCronJobs(failingCronJobs)
+	executioner.KillCronJobs(ctx, cronJobFails)
+
+	s.Policies.UpdateStatus(ctx)
+}
+
+// addHealthChecks adds liveness and readiness checks, and reports whether this replica is the leader on
+// /readyz/leader of the health probe server. Replicas that are not leader fail only that check, and are probed on
+// /readyz/ping, so that rolling updates are not blocked by the previous leader.
+func addHealthChecks(mgr manager.Manager, leader *int32) error {
+	err := mgr.AddHealthzCheck("ping", healthz.Ping)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	err = mgr.AddReadyzCheck("ping", healthz.Ping)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return mgr.AddReadyzCheck("leader", func(_ *http.Request) error {
+		if atomic.LoadInt32(leader) != 1 {
+			return errNotLeader
+		}
+
+		return nil
+	})
 }
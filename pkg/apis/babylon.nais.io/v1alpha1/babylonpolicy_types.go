@@ -0,0 +1,67 @@
+package babylon_nais_io_v1alpha1
+
+import (
+	"github.com/prometheus/alertmanager/timeinterval"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(
+		&BabylonPolicy{},
+		&BabylonPolicyList{},
+	)
+}
+
+// BabylonPolicy overrides the global configuration of Babylon for the workloads in its namespace matching its
+// selector.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path="babylonpolicies",singular="babylonpolicy"
+type BabylonPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BabylonPolicySpec   `json:"spec"`
+	Status BabylonPolicyStatus `json:"status,omitempty"`
+}
+
+// BabylonPolicyList contains a list of BabylonPolicy.
+// +kubebuilder:object:root=true
+type BabylonPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BabylonPolicy `json:"items"`
+}
+
+// BabylonPolicySpec holds the overrides, fields that are not set fall back to the global configuration.
+// Annotations on the workload itself, e.g. babylon.nais.io/grace-period, take precedence over the policy.
+type BabylonPolicySpec struct {
+	// Selector decides which workloads in the namespace are governed, an empty selector governs all of them.
+	Selector metav1.LabelSelector `json:"selector,omitempty"`
+	// RestartThreshold overrides RESTART_THRESHOLD.
+	RestartThreshold *int32 `json:"restartThreshold,omitempty"`
+	// ResourceAge overrides RESOURCE_AGE.
+	ResourceAge *metav1.Duration `json:"resourceAge,omitempty"`
+	// GracePeriod overrides GRACE_PERIOD.
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+	// NotificationDelay overrides NOTIFICATION_DELAY.
+	NotificationDelay *metav1.Duration `json:"notificationDelay,omitempty"`
+	// Strategies allowed for cleanup, e.g. abort-rollout and downscale.
+	Strategies []string `json:"strategies,omitempty"`
+	// EnabledRules are evaluated even if disabled by DISABLED_RULES.
+	EnabledRules []string `json:"enabledRules,omitempty"`
+	// DisabledRules are not evaluated.
+	DisabledRules []string `json:"disabledRules,omitempty"`
+	// ActiveTimeIntervals overrides the working hours, using the same syntax as working-hours.yaml.
+	ActiveTimeIntervals []timeinterval.TimeInterval `json:"activeTimeIntervals,omitempty"`
+}
+
+type BabylonPolicyStatus struct {
+	// GovernedWorkloads are the workloads the policy applied to when last judged.
+	GovernedWorkloads []GovernedWorkload `json:"governedWorkloads,omitempty"`
+}
+
+type GovernedWorkload struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
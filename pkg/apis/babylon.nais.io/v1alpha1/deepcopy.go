@@ -0,0 +1,152 @@
+package babylon_nais_io_v1alpha1
+
+import (
+	"github.com/prometheus/alertmanager/timeinterval"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *BabylonPolicy) DeepCopyInto(out *BabylonPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *BabylonPolicy) DeepCopy() *BabylonPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BabylonPolicy)
+	in.DeepCopyInto(out)
+
+	return out
+}
+
+func (in *BabylonPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+
+	return nil
+}
+
+func (in *BabylonPolicyList) DeepCopyInto(out *BabylonPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]BabylonPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *BabylonPolicyList) DeepCopy() *BabylonPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(BabylonPolicyList)
+	in.DeepCopyInto(out)
+
+	return out
+}
+
+func (in *BabylonPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+
+	return nil
+}
+
+func (in *BabylonPolicySpec) DeepCopyInto(out *BabylonPolicySpec) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	if in.RestartThreshold != nil {
+		out.RestartThreshold = new(int32)
+		*out.RestartThreshold = *in.RestartThreshold
+	}
+	if in.ResourceAge != nil {
+		out.ResourceAge = in.ResourceAge.DeepCopy()
+	}
+	if in.GracePeriod != nil {
+		out.GracePeriod = in.GracePeriod.DeepCopy()
+	}
+	if in.NotificationDelay != nil {
+		out.NotificationDelay = in.NotificationDelay.DeepCopy()
+	}
+	out.Strategies = copyStrings(in.Strategies)
+	out.EnabledRules = copyStrings(in.EnabledRules)
+	out.DisabledRules = copyStrings(in.DisabledRules)
+	if in.ActiveTimeIntervals != nil {
+		out.ActiveTimeIntervals = make([]timeinterval.TimeInterval, len(in.ActiveTimeIntervals))
+		for i := range in.ActiveTimeIntervals {
+			deepCopyTimeIntervalInto(&in.ActiveTimeIntervals[i], &out.ActiveTimeIntervals[i])
+		}
+	}
+}
+
+func (in *BabylonPolicySpec) DeepCopy() *BabylonPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BabylonPolicySpec)
+	in.DeepCopyInto(out)
+
+	return out
+}
+
+func (in *BabylonPolicyStatus) DeepCopyInto(out *BabylonPolicyStatus) {
+	*out = *in
+	if in.GovernedWorkloads != nil {
+		out.GovernedWorkloads = make([]GovernedWorkload, len(in.GovernedWorkloads))
+		copy(out.GovernedWorkloads, in.GovernedWorkloads)
+	}
+}
+
+func (in *BabylonPolicyStatus) DeepCopy() *BabylonPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BabylonPolicyStatus)
+	in.DeepCopyInto(out)
+
+	return out
+}
+
+// deepCopyTimeIntervalInto copies the ranges of a time interval, which only hold values.
+func deepCopyTimeIntervalInto(in, out *timeinterval.TimeInterval) {
+	*out = *in
+	if in.Times != nil {
+		out.Times = make([]timeinterval.TimeRange, len(in.Times))
+		copy(out.Times, in.Times)
+	}
+	if in.Weekdays != nil {
+		out.Weekdays = make([]timeinterval.WeekdayRange, len(in.Weekdays))
+		copy(out.Weekdays, in.Weekdays)
+	}
+	if in.DaysOfMonth != nil {
+		out.DaysOfMonth = make([]timeinterval.DayOfMonthRange, len(in.DaysOfMonth))
+		copy(out.DaysOfMonth, in.DaysOfMonth)
+	}
+	if in.Months != nil {
+		out.Months = make([]timeinterval.MonthRange, len(in.Months))
+		copy(out.Months, in.Months)
+	}
+	if in.Years != nil {
+		out.Years = make([]timeinterval.YearRange, len(in.Years))
+		copy(out.Years, in.Years)
+	}
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+
+	return out
+}
@@ -0,0 +1,58 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	nais_io_v1alpha1 "github.com/nais/liberator/pkg/apis/nais.io/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ErrFetchApplicationFailed = errors.New("failed to fetch application")
+	ErrNoImageFound           = errors.New("no image found")
+)
+
+const Kind = "Application"
+
+// GetOwner returns the nais Application owning the workload, or nil if the workload is not managed by naiserator.
+func GetOwner(ctx context.Context, c client.Client, workload metav1.Object) (*nais_io_v1alpha1.Application, error) {
+	for _, owner := range workload.GetOwnerReferences() {
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil || gv.Group != nais_io_v1alpha1.GroupVersion.Group || owner.Kind != Kind {
+			continue
+		}
+
+		app := &nais_io_v1alpha1.Application{}
+		err = c.Get(ctx, client.ObjectKey{Namespace: workload.GetNamespace(), Name: owner.Name}, app)
+		switch {
+		case k8serrors.IsNotFound(err):
+			return nil, nil
+		case err != nil:
+			return nil, fmt.Errorf("%w %s: %v", ErrFetchApplicationFailed, owner.Name, err)
+		case app.UID != owner.UID:
+			return nil, nil
+		}
+
+		return app, nil
+	}
+
+	return nil, nil
+}
+
+// GetImage returns the image of the application's container in the replicaset. Naiserator names the container
+// after the application.
+func GetImage(app *nais_io_v1alpha1.Application, replicaSet *appsv1.ReplicaSet) (string, error) {
+	for _, container := range replicaSet.Spec.Template.Spec.Containers {
+		if container.Name == app.Name {
+			return container.Image, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w for application %s in replicaset %s", ErrNoImageFound, app.Name, replicaSet.Name)
+}
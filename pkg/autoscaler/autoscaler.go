@@ -0,0 +1,112 @@
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ErrFetchAutoscalerFailed = errors.New("failed to fetch horizontal pod autoscalers")
+	ErrInvalidBackup         = errors.New("invalid horizontal pod autoscaler backup")
+)
+
+// annotationsToSkip are left out of the backup, as they describe the state of the removed autoscaler rather than how
+// to recreate it.
+var annotationsToSkip = map[string]bool{
+	v1.LastAppliedConfigAnnotation:                    true,
+	"autoscaling.alpha.kubernetes.io/conditions":      true,
+	"autoscaling.alpha.kubernetes.io/current-metrics": true,
+}
+
+// Backup is what is needed to recreate a horizontal pod autoscaler removed by babylon, including its original
+// minReplicas and maxReplicas.
+type Backup struct {
+	Name            string                                    `json:"name"`
+	Labels          map[string]string                         `json:"labels,omitempty"`
+	Annotations     map[string]string                         `json:"annotations,omitempty"`
+	OwnerReferences []metav1.OwnerReference                   `json:"ownerReferences,omitempty"`
+	Spec            autoscalingv1.HorizontalPodAutoscalerSpec `json:"spec"`
+}
+
+// GetForDeployment returns the horizontal pod autoscaler scaling the deployment, or nil if there is none.
+func GetForDeployment(
+	ctx context.Context,
+	c client.Client,
+	deploy *appsv1.Deployment) (*autoscalingv1.HorizontalPodAutoscaler, error) {
+	autoscalers := &autoscalingv1.HorizontalPodAutoscalerList{}
+	err := c.List(ctx, autoscalers, client.InNamespace(deploy.Namespace))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchAutoscalerFailed, err)
+	}
+
+	for i := range autoscalers.Items {
+		target := autoscalers.Items[i].Spec.ScaleTargetRef
+		gv, err := schema.ParseGroupVersion(target.APIVersion)
+		if err != nil || gv.Group != appsv1.GroupName || target.Kind != "Deployment" || target.Name != deploy.Name {
+			continue
+		}
+
+		return &autoscalers.Items[i], nil
+	}
+
+	return nil, nil
+}
+
+// NewBackup serializes the autoscaler, to be stored in an annotation on the deployment it scales.
+func NewBackup(hpa *autoscalingv1.HorizontalPodAutoscaler) (string, error) {
+	var annotations map[string]string
+	for k, v := range hpa.Annotations {
+		if annotationsToSkip[k] {
+			continue
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[k] = v
+	}
+
+	backup, err := json.Marshal(Backup{
+		Name:            hpa.Name,
+		Labels:          hpa.Labels,
+		Annotations:     annotations,
+		OwnerReferences: hpa.OwnerReferences,
+		Spec:            hpa.Spec,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	return string(backup), nil
+}
+
+// FromBackup returns the autoscaler to recreate in the namespace from a backup made by NewBackup.
+func FromBackup(backup, namespace string) (*autoscalingv1.HorizontalPodAutoscaler, error) {
+	var b Backup
+	err := json.Unmarshal([]byte(backup), &b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if b.Name == "" || b.Spec.MaxReplicas == 0 {
+		return nil, fmt.Errorf("%w: missing name or maxReplicas", ErrInvalidBackup)
+	}
+
+	return &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            b.Name,
+			Namespace:       namespace,
+			Labels:          b.Labels,
+			Annotations:     b.Annotations,
+			OwnerReferences: b.OwnerReferences,
+		},
+		Spec: b.Spec,
+	}, nil
+}
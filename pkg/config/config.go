@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Unleash/unleash-client-go/v3"
+	"github.com/nais/babylon/pkg/events"
 	"github.com/nais/babylon/pkg/logger"
 	"github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/alertmanager/timeinterval"
@@ -21,30 +23,104 @@ const (
 	DefaultAge                = 10 * time.Minute
 	DefaultNotificationDelay  = 24 * time.Hour
 	DefaultGracePeriod        = 24 * time.Hour
+	DefaultUnschedulableAfter = 1 * time.Hour
+	DefaultMaxUnready         = 1 * time.Hour
+	DefaultFailedJobs         = 3
+	DefaultFailureRatio       = 1.0
+	DefaultMinFailingPods     = 1
+	DefaultRestartRateWindow  = 1 * time.Hour
+	DefaultMaxRestarts        = 6
+	DefaultRestartObservation = 2
+	DefaultEventThreshold     = 10
+	DefaultEventMaxAge        = 1 * time.Hour
+	DefaultLeaderElectionID   = "babylon-leader"
+	DefaultTickTimeout        = 10 * time.Minute
+	DefaultShutdownTimeout    = 30 * time.Second
+	DefaultJudgeConcurrency   = 4
+	DefaultAPIQPS             = 20
+	DefaultAPIBurst           = 30
 	StringTrue                = "true"
+	AnnotationPrefix          = "babylon.nais.io/"
 	FailureDetectedAnnotation = "babylon.nais.io/failure-detected"
 	GracePeriodAnnotation     = "babylon.nais.io/grace-period"
 	StrategyAnnotation        = "babylon.nais.io/strategy"
 	EnabledAnnotation         = "babylon.nais.io/enabled"
+	FailureRatioAnnotation    = "babylon.nais.io/failure-ratio"
+	MinFailingPodsAnnotation  = "babylon.nais.io/min-failing-pods"
+	// LastHealthyRevisionAnnotation and LastHealthyHashAnnotation identify the replicaset of the deployment last
+	// judged healthy, which rollbacks target.
+	LastHealthyRevisionAnnotation = "babylon.nais.io/last-healthy-revision"
+	LastHealthyHashAnnotation     = "babylon.nais.io/last-healthy-hash"
+	// HealthyAnnotation marks the replicasets of deployments judged healthy, with the time they were first judged so.
+	HealthyAnnotation = "babylon.nais.io/healthy"
+	// AutoscalerBackupAnnotation holds the horizontal pod autoscaler removed when downscaling a deployment.
+	AutoscalerBackupAnnotation = "babylon.nais.io/hpa-backup"
+	// PolicyCount counts a failure towards marking the workload as failing.
+	PolicyCount = "count"
+	// PolicyReport records a failure in logs and metrics, but never marks the workload as failing.
+	PolicyReport = "report"
+	// PolicyIgnore disregards a failure entirely.
+	PolicyIgnore = "ignore"
+	// SeverityCritical custom rules mark the workload as failing.
+	SeverityCritical = "critical"
+	// SeverityWarning custom rules are recorded in logs and metrics, but never mark the workload as failing.
+	SeverityWarning = "warning"
 )
 
+var ErrInvalidFailureRatio = errors.New("invalid failure ratio")
+
 type Config struct {
-	Armed                bool
-	LogLevel             string
-	Port                 string
-	TickRate             time.Duration
-	RestartThreshold     int32
-	ResourceAge          time.Duration
-	NotificationDelay    time.Duration
-	UseAllowedNamespaces bool
-	AllowedNamespaces    []string
-	GracePeriod          time.Duration
-	ActiveTimeIntervals  map[string][]timeinterval.TimeInterval
-	InfluxdbURI          string
-	InfluxdbUsername     SecretToken
-	InfluxdbPassword     SecretToken
-	InfluxdbDatabase     string
-	Cluster              string
+	Armed                   bool
+	LogLevel                string
+	Port                    string
+	TickRate                time.Duration
+	TickTimeout             time.Duration
+	ShutdownTimeout         time.Duration
+	RestartThreshold        int32
+	ResourceAge             time.Duration
+	NotificationDelay       time.Duration
+	UseAllowedNamespaces    bool
+	AllowedNamespaces       []string
+	GracePeriod             time.Duration
+	ActiveTimeIntervals     map[string][]timeinterval.TimeInterval
+	InfluxdbURI             string
+	InfluxdbUsername        SecretToken
+	InfluxdbPassword        SecretToken
+	InfluxdbDatabase        string
+	Cluster                 string
+	DisabledRules           []string
+	FailedPodPolicies       map[string]string
+	UnschedulableAfter      time.Duration
+	MaxUnready              time.Duration
+	FailedJobsThreshold     int
+	FailureRatio            float64
+	MinFailingPods          int
+	RestartRateWindow       time.Duration
+	MaxRestartsPerWindow    int
+	RestartRateObservations int
+	SidecarContainers       []string
+	SidecarPolicy           string
+	EventReasons            []string
+	EventThreshold          int32
+	EventMaxAge             time.Duration
+	CustomRules             []CustomRule
+	JudgeConcurrency        int
+	JudgeRateLimit          float64
+	APIQPS                  float32
+	APIBurst                int
+	LeaderElection          bool
+	LeaderElectionID        string
+	LeaderElectionNamespace string
+}
+
+// CustomRule is a user-defined rule, a CEL expression evaluated against the pod, replicaset or deployment along
+// with its namespace.
+type CustomRule struct {
+	Name       string `yaml:"name"`
+	Severity   string `yaml:"severity"`
+	Reason     string `yaml:"reason"`
+	Scope      string `yaml:"scope"`
+	Expression string `yaml:"expression"`
 }
 
 type SecretToken string
@@ -63,6 +139,8 @@ func DefaultConfig() Config {
 		Port:                 "8080",
 		Armed:                false,
 		TickRate:             DefaultTickRate,
+		TickTimeout:          DefaultTickTimeout,
+		ShutdownTimeout:      DefaultShutdownTimeout,
 		RestartThreshold:     DefaultRestartThreshold,
 		ResourceAge:          DefaultAge,
 		NotificationDelay:    DefaultNotificationDelay,
@@ -74,7 +152,33 @@ func DefaultConfig() Config {
 				{Times: []timeinterval.TimeRange{{StartMinute: 0, EndMinute: 1440}}},
 			},
 		},
-		Cluster: "unknown",
+		Cluster:       "unknown",
+		DisabledRules: []string{},
+		FailedPodPolicies: map[string]string{
+			"Evicted":                  PolicyReport,
+			"DeadlineExceeded":         PolicyCount,
+			"NodeLost":                 PolicyReport,
+			"UnexpectedAdmissionError": PolicyReport,
+		},
+		UnschedulableAfter:      DefaultUnschedulableAfter,
+		MaxUnready:              DefaultMaxUnready,
+		FailedJobsThreshold:     DefaultFailedJobs,
+		FailureRatio:            DefaultFailureRatio,
+		MinFailingPods:          DefaultMinFailingPods,
+		RestartRateWindow:       DefaultRestartRateWindow,
+		MaxRestartsPerWindow:    DefaultMaxRestarts,
+		RestartRateObservations: DefaultRestartObservation,
+		SidecarContainers:       []string{"linkerd-proxy", "cloudsql-proxy", "vault-agent*"},
+		SidecarPolicy:           PolicyReport,
+		EventReasons: []string{
+			events.FailedMount, events.FailedAttachVolume, events.FailedCreatePodSandBox,
+		},
+		EventThreshold:   DefaultEventThreshold,
+		EventMaxAge:      DefaultEventMaxAge,
+		LeaderElectionID: DefaultLeaderElectionID,
+		JudgeConcurrency: DefaultJudgeConcurrency,
+		APIQPS:           DefaultAPIQPS,
+		APIBurst:         DefaultAPIBurst,
 	}
 }
 
@@ -85,11 +189,43 @@ func ParseConfig() Config {
 	cfg.Armed = GetEnv("ARMED", fmt.Sprintf("%v", cfg.Armed)) == StringTrue
 
 	cfg.LogLevel = GetEnv("LOG_LEVEL", cfg.LogLevel)
+
+	// Whether only the replica holding the lease judges and cleans up, required when running multiple replicas
+	cfg.LeaderElection = GetEnv("LEADER_ELECTION", fmt.Sprintf("%t", cfg.LeaderElection)) == StringTrue
+	cfg.LeaderElectionID = GetEnv("LEADER_ELECTION_ID", cfg.LeaderElectionID)
+	// Namespace of the lease, defaults to the namespace babylon is running in
+	cfg.LeaderElectionNamespace = GetEnv("LEADER_ELECTION_NAMESPACE", cfg.LeaderElectionNamespace)
 	cfg.Port = GetEnv("PORT", cfg.Port)
 
 	tickRate := GetEnv("TICKRATE", cfg.TickRate.String())
+	// Time a single run of the main loop may take before it is abandoned
+	tickTimeout := GetEnv("TICK_TIMEOUT", cfg.TickTimeout.String())
+	// Time in-flight cleanups are given to finish once babylon is stopped
+	shutdownTimeout := GetEnv("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout.String())
 	restartThreshold := GetEnv("RESTART_THRESHOLD", fmt.Sprintf("%d", cfg.RestartThreshold))
 
+	// Restarts per window a crash looping container may have, for a number of consecutive observations
+	restartRateWindow := GetEnv("RESTART_RATE_WINDOW", cfg.RestartRateWindow.String())
+	maxRestarts := GetEnv("MAX_RESTARTS_PER_WINDOW", fmt.Sprintf("%d", cfg.MaxRestartsPerWindow))
+	restartObservations := GetEnv("RESTART_RATE_OBSERVATIONS", fmt.Sprintf("%d", cfg.RestartRateObservations))
+
+	// Number of workloads judged in parallel, and how many may be judged per second, 0 is unlimited
+	judgeConcurrency := GetEnv("JUDGE_CONCURRENCY", fmt.Sprintf("%d", cfg.JudgeConcurrency))
+	judgeRateLimit := GetEnv("JUDGE_RATE_LIMIT", fmt.Sprintf("%v", cfg.JudgeRateLimit))
+
+	// Requests per second, and bursts thereof, the client may make to the Kubernetes API
+	apiQPS := GetEnv("KUBE_API_QPS", fmt.Sprintf("%v", cfg.APIQPS))
+	apiBurst := GetEnv("KUBE_API_BURST", fmt.Sprintf("%d", cfg.APIBurst))
+
+	// Number of consecutive failed jobs before a cronjob is considered failing
+	failedJobsThreshold := GetEnv("FAILED_JOBS_THRESHOLD", fmt.Sprintf("%d", cfg.FailedJobsThreshold))
+
+	// Share of the pods in a replicaset that must be failing for it to be considered failing, e.g. 0.5
+	failureRatio := GetEnv("FAILURE_RATIO", fmt.Sprintf("%v", cfg.FailureRatio))
+
+	// Number of pods in a replicaset that must be failing for it to be considered failing
+	minFailingPods := GetEnv("MIN_FAILING_PODS", fmt.Sprintf("%d", cfg.MinFailingPods))
+
 	// Resource age needed before rollback
 	resourceAge := GetEnv("RESOURCE_AGE", "1h")
 
@@ -98,6 +234,12 @@ func ParseConfig() Config {
 
 	gracePeriod := GetEnv("GRACE_PERIOD", fmt.Sprintf("%d", cfg.GracePeriod))
 
+	// Time a pod may be unschedulable before it is considered failing
+	unschedulableAfter := GetEnv("UNSCHEDULABLE_AFTER", cfg.UnschedulableAfter.String())
+
+	// Time a running pod may fail its readiness probes, in addition to the deployment's minReadySeconds
+	maxUnready := GetEnv("MAX_UNREADY", cfg.MaxUnready.String())
+
 	cfg.UseAllowedNamespaces = GetEnv("USE_ALLOWED_NAMESPACES",
 		fmt.Sprintf("%t", cfg.UseAllowedNamespaces)) == StringTrue
 
@@ -118,10 +260,49 @@ func ParseConfig() Config {
 
 	cfg.Cluster = GetEnv("CLUSTER", cfg.Cluster)
 
+	disabledRules := GetEnv("DISABLED_RULES", "")
+	cfg.DisabledRules = strings.Split(disabledRules, ",")
+
+	// Policy per reason for pods in phase Failed, e.g. Evicted=report,DeadlineExceeded=count
+	failedPodPolicies := GetEnv("FAILED_POD_POLICY", "")
+	for reason, policy := range parseKeyValues(failedPodPolicies) {
+		if !IsValidPolicy(policy) {
+			log.Warnf("ignoring FAILED_POD_POLICY for %s: invalid policy %q", reason, policy)
+
+			continue
+		}
+		cfg.FailedPodPolicies[reason] = policy
+	}
+
+	// Container name patterns, e.g. vault-*, of sidecars whose failures are infrastructure failures
+	if sidecarContainers, ok := os.LookupEnv("SIDECAR_CONTAINERS"); ok {
+		cfg.SidecarContainers = strings.Split(sidecarContainers, ",")
+	}
+	if sidecarPolicy := GetEnv("SIDECAR_POLICY", cfg.SidecarPolicy); IsValidPolicy(sidecarPolicy) {
+		cfg.SidecarPolicy = sidecarPolicy
+	} else {
+		log.Warnf("ignoring SIDECAR_POLICY: invalid policy %q", sidecarPolicy)
+	}
+
+	// Reasons of warning events that fail the object they involve, once they have occurred a number of times
+	if eventReasons, ok := os.LookupEnv("EVENT_REASONS"); ok {
+		cfg.EventReasons = strings.Split(eventReasons, ",")
+	}
+	eventThreshold := GetEnv("EVENT_THRESHOLD", fmt.Sprintf("%d", cfg.EventThreshold))
+	eventMaxAge := GetEnv("EVENT_MAX_AGE", cfg.EventMaxAge.String())
+
 	duration, err := time.ParseDuration(tickRate)
 	if err == nil {
 		cfg.TickRate = duration
 	}
+	tt, err := time.ParseDuration(tickTimeout)
+	if err == nil {
+		cfg.TickTimeout = tt
+	}
+	st, err := time.ParseDuration(shutdownTimeout)
+	if err == nil {
+		cfg.ShutdownTimeout = st
+	}
 	age, err := time.ParseDuration(resourceAge)
 	if err == nil {
 		cfg.ResourceAge = age
@@ -135,11 +316,85 @@ func ParseConfig() Config {
 		cfg.GracePeriod = gp
 	}
 
+	ua, err := time.ParseDuration(unschedulableAfter)
+	if err == nil {
+		cfg.UnschedulableAfter = ua
+	}
+
+	mu, err := time.ParseDuration(maxUnready)
+	if err == nil {
+		cfg.MaxUnready = mu
+	}
+
 	rt, err := strconv.ParseInt(restartThreshold, 10, 32)
 	if err == nil {
 		cfg.RestartThreshold = int32(rt)
 	}
 
+	rw, err := time.ParseDuration(restartRateWindow)
+	if err == nil {
+		cfg.RestartRateWindow = rw
+	}
+
+	mr, err := strconv.Atoi(maxRestarts)
+	if err == nil {
+		cfg.MaxRestartsPerWindow = mr
+	}
+
+	ro, err := strconv.Atoi(restartObservations)
+	if err == nil && ro > 0 {
+		cfg.RestartRateObservations = ro
+	}
+
+	et, err := strconv.ParseInt(eventThreshold, 10, 32)
+	if err == nil {
+		cfg.EventThreshold = int32(et)
+	}
+
+	ea, err := time.ParseDuration(eventMaxAge)
+	if err == nil {
+		cfg.EventMaxAge = ea
+	}
+
+	fj, err := strconv.Atoi(failedJobsThreshold)
+	if err == nil {
+		cfg.FailedJobsThreshold = fj
+	}
+
+	jc, err := strconv.Atoi(judgeConcurrency)
+	if err == nil && jc > 0 {
+		cfg.JudgeConcurrency = jc
+	}
+
+	jr, err := strconv.ParseFloat(judgeRateLimit, 64)
+	if err == nil && jr >= 0 {
+		cfg.JudgeRateLimit = jr
+	}
+
+	qps, err := strconv.ParseFloat(apiQPS, 32)
+	if err == nil && qps > 0 {
+		cfg.APIQPS = float32(qps)
+	}
+
+	burst, err := strconv.Atoi(apiBurst)
+	if err == nil && burst > 0 {
+		cfg.APIBurst = burst
+	}
+
+	fr, err := ParseFailureRatio(failureRatio)
+	if err == nil {
+		cfg.FailureRatio = fr
+	} else {
+		log.Warnf("ignoring FAILURE_RATIO: %v", err)
+	}
+
+	mf, err := strconv.Atoi(minFailingPods)
+	if err == nil && mf > 0 {
+		cfg.MinFailingPods = mf
+	}
+
+	cfg.CustomRules = parseCustomRules("/etc/config/rules.yaml")
+
 	var intervals []config.MuteTimeInterval
 	file, err := os.ReadFile("/etc/config/working-hours.yaml")
 	if err != nil {
@@ -186,6 +441,77 @@ func ConfigureUnleash() (*unleash.Client, error) {
 	return unleashClient, nil
 }
 
+// ParseFailureRatio parses a failing ratio, which must be greater than 0 and at most 1.
+func ParseFailureRatio(s string) (float64, error) {
+	ratio, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidFailureRatio, err)
+	}
+	if ratio <= 0 || ratio > 1 {
+		return 0, fmt.Errorf("%w: %v is not in (0, 1]", ErrInvalidFailureRatio, ratio)
+	}
+
+	return ratio, nil
+}
+
+// parseCustomRules reads custom rules from a file, rules without a name, reason or expression are skipped.
+func parseCustomRules(path string) []CustomRule {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		log.Infof("error reading custom rules: %v", err)
+
+		return nil
+	}
+
+	var rules []CustomRule
+	err = yaml.Unmarshal(file, &rules)
+	if err != nil {
+		log.Errorf("error parsing custom rules: %v", err)
+
+		return nil
+	}
+
+	valid := make([]CustomRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" || rule.Reason == "" || rule.Expression == "" {
+			log.Errorf("custom rule %+v must have a name, reason and expression, skipping", rule)
+
+			continue
+		}
+		if rule.Severity == "" {
+			rule.Severity = SeverityWarning
+		}
+		valid = append(valid, rule)
+	}
+	log.Infof("custom rules: %v", valid)
+
+	return valid
+}
+
+// IsValidPolicy returns whether the policy is one of PolicyCount, PolicyReport and PolicyIgnore.
+func IsValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyCount, PolicyReport, PolicyIgnore:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseKeyValues parses comma-separated key=value pairs, ignoring malformed pairs.
+func parseKeyValues(s string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return values
+}
+
 func GetEnv(name, fallback string) string {
 	if value, ok := os.LookupEnv(name); ok {
 		return value
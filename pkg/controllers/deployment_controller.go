@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/nais/babylon/pkg/criteria"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// deadlineSlack is added to the requeue of a deployment in its grace period, so that it has passed when reconciled.
+const deadlineSlack = time.Second
+
+// DeploymentReconciler judges a deployment whenever it, its replicasets or their pods change, rather than waiting
+// for the next tick of the gardener. Deployments in their grace period are requeued for when it expires.
+type DeploymentReconciler struct {
+	Client      client.Client
+	Judge       *criteria.CoreCriteriaJudge
+	CleanUp     *criteria.CleanUpJudge
+	Executioner *criteria.Executioner
+}
+
+func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv1.Deployment{}).
+		Owns(&appsv1.ReplicaSet{}).
+		Watches(&v1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.deploymentOfPod)).
+		Complete(r)
+}
+
+func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	deployments := &appsv1.DeploymentList{Items: make([]appsv1.Deployment, 1)}
+	err := r.Client.Get(ctx, req.NamespacedName, &deployments.Items[0])
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	r.Executioner.RestoreAutoscalers(ctx, deployments.Items)
+
+	fails := r.Judge.Failing(ctx, deployments)
+	r.Executioner.Kill(ctx, r.CleanUp.Judge(fails))
+	if len(fails) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	deadline, ok := r.CleanUp.Deadline(fails[0])
+	if !ok || !time.Now().Before(deadline) {
+		return ctrl.Result{}, nil
+	}
+	log.Debugf("Requeuing %s for when its grace period expires at %v", req.NamespacedName, deadline)
+
+	return ctrl.Result{RequeueAfter: time.Until(deadline) + deadlineSlack}, nil
+}
+
+// deploymentOfPod maps a pod to the deployment controlling its replicaset, if any.
+func (r *DeploymentReconciler) deploymentOfPod(ctx context.Context, pod client.Object) []reconcile.Request {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return nil
+	}
+
+	rs := &appsv1.ReplicaSet{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: pod.GetNamespace(), Name: owner.Name}, rs)
+	if err != nil {
+		log.Tracef("Could not get replicaset of pod %s: %v", pod.GetName(), err)
+
+		return nil
+	}
+
+	owner = metav1.GetControllerOf(rs)
+	if owner == nil || owner.Kind != "Deployment" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: pod.GetNamespace(), Name: owner.Name}}}
+}
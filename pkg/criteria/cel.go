@@ -0,0 +1,164 @@
+package criteria
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/nais/babylon/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var ErrInvalidRule = errors.New("invalid custom rule")
+
+// NewCELRules compiles custom rules, rules that do not compile are logged and skipped. The namespace of the
+// subject is looked up using the client, if any.
+func NewCELRules(customRules []config.CustomRule, c client.Client) []Rule {
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("pod", decls.Dyn),
+		decls.NewVar("replicaset", decls.Dyn),
+		decls.NewVar("deployment", decls.Dyn),
+		decls.NewVar("ns", decls.Dyn),
+		decls.NewVar("now", decls.Timestamp),
+	))
+	if err != nil {
+		log.Errorf("error creating CEL environment: %v", err)
+
+		return nil
+	}
+
+	rules := make([]Rule, 0, len(customRules))
+	for _, customRule := range customRules {
+		rule, err := newCELRule(env, customRule, c)
+		if err != nil {
+			log.Errorf("error compiling custom rule %s: %v", customRule.Name, err)
+
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+func newCELRule(env *cel.Env, customRule config.CustomRule, c client.Client) (*celRule, error) {
+	var scope Scope
+	switch customRule.Scope {
+	case "", "pod":
+		scope = PodScope
+	case "replicaset":
+		scope = ReplicaSetScope
+	case "deployment":
+		scope = DeploymentScope
+	default:
+		return nil, fmt.Errorf("%w: unknown scope %s", ErrInvalidRule, customRule.Scope)
+	}
+
+	if customRule.Severity != config.SeverityCritical && customRule.Severity != config.SeverityWarning {
+		return nil, fmt.Errorf("%w: unknown severity %s", ErrInvalidRule, customRule.Severity)
+	}
+
+	ast, issues := env.Compile(customRule.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, issues.Err())
+	}
+	if !proto.Equal(ast.ResultType(), decls.Bool) && !proto.Equal(ast.ResultType(), decls.Dyn) {
+		return nil, fmt.Errorf("%w: expression must evaluate to a bool, not %v", ErrInvalidRule, ast.ResultType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	return &celRule{spec: customRule, scope: scope, program: program, client: c}, nil
+}
+
+type celRule struct {
+	spec    config.CustomRule
+	scope   Scope
+	program cel.Program
+	client  client.Client
+}
+
+func (r *celRule) Name() string { return r.spec.Name }
+func (r *celRule) Scope() Scope { return r.scope }
+
+func (r *celRule) Evaluate(subject *Subject) *Verdict {
+	var namespace string
+	vars := map[string]interface{}{"now": time.Now()}
+	for name, object := range map[string]client.Object{
+		"pod":        subject.Pod,
+		"replicaset": subject.ReplicaSet,
+		"deployment": subject.Deployment,
+	} {
+		vars[name] = toMap(object)
+		if !isNil(object) {
+			namespace = object.GetNamespace()
+		}
+	}
+	vars["ns"] = r.namespace(namespace)
+
+	out, _, err := r.program.Eval(vars)
+	if err != nil {
+		// e.g. fields that are not set on the subject, which means the rule does not apply
+		log.Tracef("custom rule %s not evaluated for %s: %v", r.spec.Name, subject.name(), err)
+
+		return nil
+	}
+
+	if matched, ok := out.Value().(bool); !ok || !matched {
+		return nil
+	}
+
+	return &Verdict{
+		Reason:     r.spec.Reason,
+		Message:    "custom rule " + r.spec.Name + " matched",
+		Details:    map[string]string{"severity": r.spec.Severity},
+		ReportOnly: r.spec.Severity == config.SeverityWarning,
+	}
+}
+
+func (r *celRule) namespace(name string) map[string]interface{} {
+	if r.client == nil || name == "" {
+		return map[string]interface{}{}
+	}
+
+	namespace := &v1.Namespace{}
+	err := r.client.Get(context.Background(), client.ObjectKey{Name: name}, namespace)
+	if err != nil {
+		log.Errorf("Failed to get namespace %v for custom rule %s, got error %v", name, r.spec.Name, err)
+
+		return map[string]interface{}{}
+	}
+
+	return toMap(namespace)
+}
+
+// toMap converts an object to the map CEL expressions are evaluated against, nil objects become an empty map.
+func toMap(object client.Object) map[string]interface{} {
+	if isNil(object) {
+		return map[string]interface{}{}
+	}
+
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		log.Errorf("error converting %s for custom rules: %v", object.GetName(), err)
+
+		return map[string]interface{}{}
+	}
+
+	return m
+}
+
+func isNil(object client.Object) bool {
+	return object == nil || reflect.ValueOf(object).IsNil()
+}
@@ -0,0 +1,111 @@
+package criteria
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nais/babylon/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCELRules(t *testing.T) {
+	t.Parallel()
+
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "default",
+		Labels: map[string]string{"environment": "dev"},
+	}}
+	pod := makePodWithState(metav1.ObjectMeta{Name: "pod", Namespace: "default"}, v1.PodStatus{
+		Phase:     v1.PodPending,
+		StartTime: &metav1.Time{Time: time.Now().Add(-3 * time.Hour)},
+		ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "app",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+		}},
+	})
+	waitingTooLong := `pod.status.containerStatuses.exists(c, has(c.state.waiting) &&
+		c.state.waiting.reason == "ContainerCreating") && now - timestamp(pod.status.startTime) > duration("2h")`
+
+	cases := []struct {
+		Name               string
+		Rule               config.CustomRule
+		ExpectedCompiled   bool
+		ExpectedReason     string
+		ExpectedReportOnly bool
+	}{
+		{
+			Name: "Waiting for more than 2h in labelled namespace",
+			Rule: config.CustomRule{
+				Name: "slow-start", Severity: config.SeverityCritical, Reason: "SlowStart",
+				Expression: waitingTooLong + ` && ns.metadata.labels["environment"] == "dev"`,
+			},
+			ExpectedCompiled: true,
+			ExpectedReason:   "SlowStart",
+		},
+		{
+			Name: "Warning severity is only reported",
+			Rule: config.CustomRule{
+				Name: "slow-start", Severity: config.SeverityWarning, Reason: "SlowStart", Expression: waitingTooLong,
+			},
+			ExpectedCompiled:   true,
+			ExpectedReason:     "SlowStart",
+			ExpectedReportOnly: true,
+		},
+		{
+			Name: "Namespace not labelled",
+			Rule: config.CustomRule{
+				Name: "slow-start", Severity: config.SeverityCritical, Reason: "SlowStart",
+				Expression: waitingTooLong + ` && ns.metadata.labels["environment"] == "prod"`,
+			},
+			ExpectedCompiled: true,
+		},
+		{
+			Name: "Missing field does not match",
+			Rule: config.CustomRule{
+				Name: "missing", Severity: config.SeverityCritical, Reason: "Missing",
+				Expression: `deployment.spec.paused`,
+			},
+			ExpectedCompiled: true,
+		},
+		{
+			Name: "Expression must be a bool",
+			Rule: config.CustomRule{
+				Name: "string", Severity: config.SeverityCritical, Reason: "String", Expression: `"failing"`,
+			},
+			ExpectedCompiled: false,
+		},
+		{
+			Name: "Syntax error",
+			Rule: config.CustomRule{
+				Name: "syntax", Severity: config.SeverityCritical, Reason: "Syntax", Expression: `pod.status.(`,
+			},
+			ExpectedCompiled: false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newFakeClientBuilder().WithObjects(namespace).Build()
+			rules := NewCELRules([]config.CustomRule{tt.Rule}, c)
+			if (len(rules) == 1) != tt.ExpectedCompiled {
+				t.Fatalf("Expected rule to compile: %v, got %d rules", tt.ExpectedCompiled, len(rules))
+			}
+			if !tt.ExpectedCompiled {
+				return
+			}
+
+			reason, reportOnly := "", false
+			if verdict := rules[0].Evaluate(&Subject{Pod: &pod}); verdict != nil {
+				reason, reportOnly = verdict.Reason, verdict.ReportOnly
+			}
+			if reason != tt.ExpectedReason || reportOnly != tt.ExpectedReportOnly {
+				t.Fatalf("Expected reason %q (report only: %v), got %q (report only: %v)",
+					tt.ExpectedReason, tt.ExpectedReportOnly, reason, reportOnly)
+			}
+		})
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"time"
 
 	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/policy"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type CleanUpJudge struct {
@@ -14,6 +18,7 @@ type CleanUpJudge struct {
 	allowedNamespaces    []string
 	gracePeriod          time.Duration
 	notificationDelay    time.Duration
+	policies             *policy.Store
 }
 
 func NewCleanUpJudge(config *config.Config) *CleanUpJudge {
@@ -25,11 +30,17 @@ func NewCleanUpJudge(config *config.Config) *CleanUpJudge {
 	}
 }
 
+// WithPolicies makes the judge apply the BabylonPolicies in the store to the workloads it governs.
+func (j *CleanUpJudge) WithPolicies(policies *policy.Store) *CleanUpJudge {
+	j.policies = policies
+
+	return j
+}
+
 func (j *CleanUpJudge) Judge(deployments []*appsv1.Deployment) []*appsv1.Deployment {
 	var filteredDeployments []*appsv1.Deployment
 	for i := range deployments {
-		if j.filterByAllowedNamespace(deployments[i]) &&
-			j.filterByNotified(deployments[i]) {
+		if j.isReady(deployments[i]) {
 			filteredDeployments = append(filteredDeployments, deployments[i])
 		}
 	}
@@ -37,12 +48,39 @@ func (j *CleanUpJudge) Judge(deployments []*appsv1.Deployment) []*appsv1.Deploym
 	return filteredDeployments
 }
 
-func (j *CleanUpJudge) filterByAllowedNamespace(deployment *appsv1.Deployment) bool {
+func (j *CleanUpJudge) JudgeStatefulSets(statefulSets []*appsv1.StatefulSet) []*appsv1.StatefulSet {
+	var filteredStatefulSets []*appsv1.StatefulSet
+	for i := range statefulSets {
+		if j.isReady(statefulSets[i]) {
+			filteredStatefulSets = append(filteredStatefulSets, statefulSets[i])
+		}
+	}
+
+	return filteredStatefulSets
+}
+
+func (j *CleanUpJudge) JudgeCronJobs(cronJobs []*batchv1.CronJob) []*batchv1.CronJob {
+	var filteredCronJobs []*batchv1.CronJob
+	for i := range cronJobs {
+		if j.isReady(cronJobs[i]) {
+			filteredCronJobs = append(filteredCronJobs, cronJobs[i])
+		}
+	}
+
+	return filteredCronJobs
+}
+
+// isReady returns whether the workload may be cleaned up.
+func (j *CleanUpJudge) isReady(workload client.Object) bool {
+	return j.filterByAllowedNamespace(workload) && j.filterByNotified(workload)
+}
+
+func (j *CleanUpJudge) filterByAllowedNamespace(workload metav1.Object) bool {
 	if !j.useAllowedNamespaces {
 		return true
 	}
 
-	namespace := deployment.Namespace
+	namespace := workload.GetNamespace()
 	for i := range j.allowedNamespaces {
 		if j.allowedNamespaces[i] == "" {
 			continue
@@ -58,36 +96,61 @@ func (j *CleanUpJudge) filterByAllowedNamespace(deployment *appsv1.Deployment) b
 	return false
 }
 
-func (j *CleanUpJudge) filterByNotified(deployment *appsv1.Deployment) bool {
-	if failTime, ok := deployment.Annotations[config.FailureDetectedAnnotation]; ok {
-		firstDetectedAsFailing, err := time.Parse(time.RFC3339, failTime)
-		switch {
-		case err != nil:
-			log.Warnf("Could not parse %s for %s: %v", config.FailureDetectedAnnotation, deployment.Name, err)
+func (j *CleanUpJudge) filterByNotified(workload client.Object) bool {
+	deadline, ok := j.Deadline(workload)
+	if !ok {
+		return false
+	}
+
+	if time.Now().Before(deadline) {
+		log.Infof(
+			"not yet ready to prune %s, too early since last notification: %s",
+			workload.GetName(), workload.GetAnnotations()[config.FailureDetectedAnnotation])
 
-			return false
-		case time.Since(firstDetectedAsFailing) < j.graceDuration(deployment)+j.notificationDelay:
-			log.Infof(
-				"not yet ready to prune deployment %s, too early since last notification: %s",
-				deployment.Name, firstDetectedAsFailing.String())
+		return false
+	}
 
-			return false
-		}
+	return true
+}
 
-		return true
+// Deadline returns when the grace period and notification delay of a workload flagged as failing have passed, false
+// if the workload has not been flagged.
+func (j *CleanUpJudge) Deadline(workload client.Object) (time.Time, bool) {
+	failTime, ok := workload.GetAnnotations()[config.FailureDetectedAnnotation]
+	if !ok {
+		return time.Time{}, false
 	}
 
-	return false
+	firstDetectedAsFailing, err := time.Parse(time.RFC3339, failTime)
+	if err != nil {
+		log.Warnf("Could not parse %s for %s: %v", config.FailureDetectedAnnotation, workload.GetName(), err)
+
+		return time.Time{}, false
+	}
+
+	return firstDetectedAsFailing.Add(j.graceDuration(workload) + j.notificationDelayOf(workload)), true
 }
 
-func (j *CleanUpJudge) graceDuration(deployment *appsv1.Deployment) time.Duration {
-	gracePeriod, err := time.ParseDuration(deployment.Annotations[config.GracePeriodAnnotation])
+func (j *CleanUpJudge) graceDuration(workload client.Object) time.Duration {
+	gracePeriod, err := time.ParseDuration(workload.GetAnnotations()[config.GracePeriodAnnotation])
 	if err != nil {
-		log.Infof("Failed to parse duration for deployment %s: %s",
-			deployment.Name, deployment.Annotations[config.GracePeriodAnnotation])
+		log.Infof("Failed to parse duration for %s: %s",
+			workload.GetName(), workload.GetAnnotations()[config.GracePeriodAnnotation])
+
+		if policy := j.policies.For(workload); policy != nil && policy.GracePeriod != nil {
+			return policy.GracePeriod.Duration
+		}
 
 		return j.gracePeriod
 	}
 
 	return gracePeriod
 }
+
+func (j *CleanUpJudge) notificationDelayOf(workload client.Object) time.Duration {
+	if policy := j.policies.For(workload); policy != nil && policy.NotificationDelay != nil {
+		return policy.NotificationDelay.Duration
+	}
+
+	return j.notificationDelay
+}
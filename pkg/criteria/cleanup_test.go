@@ -1,11 +1,18 @@
 package criteria
 
 import (
+	"context"
+	"testing"
+	"time"
+
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
 	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/policy"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"testing"
-	"time"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestCleanUpJudge_filterByNamespace(t *testing.T) {
@@ -180,6 +187,94 @@ func TestCleanUpJudge_Judge_notification_timeout(t *testing.T) {
 	}
 }
 
+func TestCleanUpJudge_Deadline(t *testing.T) {
+	failureDetected := time.Now().Truncate(time.Second)
+	judge := CleanUpJudge{gracePeriod: time.Hour, notificationDelay: 10 * time.Minute}
+
+	deployment := createDeployment("", map[string]string{
+		config.FailureDetectedAnnotation: failureDetected.Format(time.RFC3339),
+		config.GracePeriodAnnotation:     "10s"})
+	deadline, ok := judge.Deadline(&deployment)
+	if expected := failureDetected.Add(10*time.Second + 10*time.Minute); !ok || !deadline.Equal(expected) {
+		t.Fatalf("Expected deadline %v, got %v (%v)", expected, deadline, ok)
+	}
+
+	healthy := createDeployment("", nil)
+	if _, ok := judge.Deadline(&healthy); ok {
+		t.Fatal("Expected no deadline for deployment not flagged as failing")
+	}
+}
+
+func TestCleanUpJudge_Judge_policy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = babylon_nais_io_v1alpha1.AddToScheme(scheme)
+
+	babylonPolicy := &babylon_nais_io_v1alpha1.BabylonPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "default"},
+		Spec: babylon_nais_io_v1alpha1.BabylonPolicySpec{
+			Selector:    metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			GracePeriod: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	c := newFakeClientBuilder().
+		WithScheme(scheme).
+		WithObjects(babylonPolicy).
+		WithStatusSubresource(babylonPolicy).
+		Build()
+	policies := policy.NewStore(c)
+	if err := policies.Refresh(context.Background()); err != nil {
+		t.Fatalf("Expected policies to refresh, got error: %v", err)
+	}
+
+	failureDetected := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	governed := createDeployment("default", map[string]string{config.FailureDetectedAnnotation: failureDetected})
+	governed.Name, governed.Labels = "governed", map[string]string{"team": "a"}
+	other := createDeployment("default", map[string]string{config.FailureDetectedAnnotation: failureDetected})
+	other.Name, other.Labels = "other", map[string]string{"team": "b"}
+
+	judge := NewCleanUpJudge(&config.Config{GracePeriod: 0}).WithPolicies(policies)
+	actual := judge.Judge([]*appsv1.Deployment{&governed, &other})
+	if len(actual) != 1 || actual[0].Name != "other" {
+		t.Fatalf("Expected only the deployment not governed by the policy to be ready, actual = %v", actual)
+	}
+
+	policies.UpdateStatus(context.Background())
+	updated := &babylon_nais_io_v1alpha1.BabylonPolicy{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(babylonPolicy), updated)
+	expected := []babylon_nais_io_v1alpha1.GovernedWorkload{{Kind: "Deployment", Name: "governed"}}
+	if len(updated.Status.GovernedWorkloads) != 1 || updated.Status.GovernedWorkloads[0] != expected[0] {
+		t.Fatalf("Expected status to list %v, got %v", expected, updated.Status.GovernedWorkloads)
+	}
+}
+
+func TestCleanUpJudge_Judge_policyChanged(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = babylon_nais_io_v1alpha1.AddToScheme(scheme)
+
+	babylonPolicy := &babylon_nais_io_v1alpha1.BabylonPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "default"},
+		Spec:       babylon_nais_io_v1alpha1.BabylonPolicySpec{GracePeriod: &metav1.Duration{Duration: time.Hour}},
+	}
+	c := newFakeClientBuilder().WithScheme(scheme).Build()
+	policies := policy.NewStore(c)
+	judge := NewCleanUpJudge(&config.Config{GracePeriod: 0}).WithPolicies(policies)
+
+	failureDetected := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	deploy := createDeployment("default", map[string]string{config.FailureDetectedAnnotation: failureDetected})
+	if actual := judge.Judge([]*appsv1.Deployment{&deploy}); len(actual) != 1 {
+		t.Fatalf("Expected deployment without policy to be ready, actual = %v", actual)
+	}
+
+	// added to the cache between ticks
+	_ = c.Create(context.Background(), babylonPolicy)
+	policies.OnAdd(babylonPolicy, false)
+	if actual := judge.Judge([]*appsv1.Deployment{&deploy}); len(actual) != 0 {
+		t.Fatalf("Expected policy to apply before the next tick, actual = %v", actual)
+	}
+}
+
 func createDeployment(namespace string, annotations map[string]string) appsv1.Deployment {
 	return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
 		Namespace:   namespace,
@@ -3,26 +3,41 @@ package criteria
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/Unleash/unleash-client-go/v3"
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
 	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/cronjob"
 	"github.com/nais/babylon/pkg/deployment"
 	"github.com/nais/babylon/pkg/metrics"
+	"github.com/nais/babylon/pkg/policy"
+	"github.com/nais/babylon/pkg/statefulset"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/strings/slices"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type CoreCriteriaJudge struct {
-	client           client.Client
-	metrics          *metrics.Metrics
-	history          *metrics.History
-	unleash          *unleash.Client
-	restartThreshold int32
-	resourceAge      time.Duration
-	armed            bool
+	client      client.Client
+	metrics     *metrics.Metrics
+	history     *metrics.History
+	unleash     *unleash.Client
+	rules       *RuleRegistry
+	resourceAge time.Duration
+	failedJobs  int
+	threshold   failureThreshold
+	sidecars    *sidecars
+	policies    *policy.Store
+	pool        *pool
+	armed       bool
+	// onChange judges are not periodic, so rule activations and history are left to the periodic judge
+	onChange bool
 }
 
 func NewCoreCriteriaJudge(
@@ -32,51 +47,218 @@ func NewCoreCriteriaJudge(
 	history *metrics.History,
 	unleash *unleash.Client,
 	armed bool) *CoreCriteriaJudge {
+	rules := DefaultRuleRegistry(config)
+	rules.Register(NewCELRules(config.CustomRules, client)...)
+
 	return &CoreCriteriaJudge{
-		client:           client,
-		metrics:          metric,
-		history:          history,
-		unleash:          unleash,
-		restartThreshold: config.RestartThreshold,
-		resourceAge:      config.ResourceAge,
-		armed:            armed,
+		client:      client,
+		metrics:     metric,
+		history:     history,
+		unleash:     unleash,
+		rules:       rules,
+		resourceAge: config.ResourceAge,
+		failedJobs:  config.FailedJobsThreshold,
+		threshold:   failureThreshold{ratio: config.FailureRatio, minPods: config.MinFailingPods},
+		sidecars:    &sidecars{patterns: config.SidecarContainers, policy: config.SidecarPolicy},
+		pool:        newPool(config.JudgeConcurrency, config.JudgeRateLimit),
+		armed:       armed,
 	}
 }
 
+// WithPolicies makes the judge apply the BabylonPolicies in the store to the workloads it governs.
+func (d *CoreCriteriaJudge) WithPolicies(policies *policy.Store) *CoreCriteriaJudge {
+	d.policies = policies
+
+	return d
+}
+
+// OnChange returns a judge for judging workloads as they change, sharing rules, policies and restart rates with d.
+// As a failing workload changes far more often than it is judged periodically, rule activations and history are
+// only recorded by d, once per tick.
+func (d *CoreCriteriaJudge) OnChange() *CoreCriteriaJudge {
+	judge := *d
+	judge.onChange = true
+
+	return &judge
+}
+
+// Rules returns the registry of rules used by the judge, site-specific rules can be registered here.
+func (d *CoreCriteriaJudge) Rules() *RuleRegistry {
+	return d.rules
+}
+
 func (d *CoreCriteriaJudge) Failing(ctx context.Context, deployments *appsv1.DeploymentList) []*appsv1.Deployment {
-	var fails []*appsv1.Deployment
-	for i := range deployments.Items {
+	failing := d.pool.run(ctx, len(deployments.Items), "deployments", func(i int) bool {
 		deploy := &deployments.Items[i]
-		if d.unleash != nil && d.unleash.IsEnabled("babylon_remove_first_detected_annotation") {
-			log.Info("Annotation removal active.")
-			d.flagHealthyDeployment(ctx, deploy)
+		failing, verdicts := d.isFailing(ctx, deploy)
+
+		return d.record(ctx, deploy, failing, verdicts)
+	})
+
+	var fails []*appsv1.Deployment
+	for i := range failing {
+		if failing[i] {
+			fails = append(fails, &deployments.Items[i])
 		}
+	}
+
+	return fails
+}
 
-		if failing, reasons := d.isFailing(ctx, deploy); failing {
-			_, err := d.flagFailingDeployment(ctx, deploy)
-			if err != nil {
-				log.Errorf("failed to add notification annotation to deployment %s, err: %v", deploy.Name, err)
+func (d *CoreCriteriaJudge) FailingStatefulSets(
+	ctx context.Context,
+	statefulSets *appsv1.StatefulSetList) []*appsv1.StatefulSet {
+	failing := d.pool.run(ctx, len(statefulSets.Items), "statefulsets", func(i int) bool {
+		sts := &statefulSets.Items[i]
+		failing, verdicts := d.isStatefulSetFailing(ctx, sts)
 
-				continue
-			}
+		return d.record(ctx, sts, failing, verdicts)
+	})
 
-			d.historizeDeployment(ctx, reasons, deploy)
-			d.metrics.SetDeploymentStatus(deploy, d.metrics.SlackChannel(ctx, deploy.Namespace), d.armed, metrics.FAILING)
-			fails = append(fails, deploy)
-		} else {
-			d.flagHealthyDeployment(ctx, deploy)
-			d.metrics.SetDeploymentStatus(deploy, d.metrics.SlackChannel(ctx, deploy.Namespace), d.armed, metrics.OK)
+	var fails []*appsv1.StatefulSet
+	for i := range failing {
+		if failing[i] {
+			fails = append(fails, &statefulSets.Items[i])
+		}
+	}
+
+	return fails
+}
+
+func (d *CoreCriteriaJudge) FailingCronJobs(ctx context.Context, cronJobs *batchv1.CronJobList) []*batchv1.CronJob {
+	failing := d.pool.run(ctx, len(cronJobs.Items), "cronjobs", func(i int) bool {
+		cronJob := &cronJobs.Items[i]
+		if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+			// restart the grace period once the cronjob is resumed
+			d.flagHealthy(ctx, cronJob)
+
+			return false
+		}
+		failing, verdicts := d.isCronJobFailing(ctx, cronJob)
+
+		return d.record(ctx, cronJob, failing, verdicts)
+	})
+
+	var fails []*batchv1.CronJob
+	for i := range failing {
+		if failing[i] {
+			fails = append(fails, &cronJobs.Items[i])
 		}
 	}
 
 	return fails
 }
 
-func (d *CoreCriteriaJudge) isFailing(ctx context.Context, deploy *appsv1.Deployment) (bool, []string) {
-	minDeploymentAge := time.Now().Add(-d.resourceAge)
-	if deploy.CreationTimestamp.After(minDeploymentAge) {
-		log.Debugf("deployment %s too young, skipping (%v)", deploy.Name, deploy.CreationTimestamp)
+// record flags the workload and updates metrics and history, returns whether the workload should be
+// considered for cleanup.
+func (d *CoreCriteriaJudge) record(ctx context.Context, workload client.Object, failing bool, verdicts []Verdict) bool {
+	if d.unleash != nil && d.unleash.IsEnabled("babylon_remove_first_detected_annotation") {
+		log.Info("Annotation removal active.")
+		d.flagHealthy(ctx, workload)
+	}
+
+	if !failing {
+		d.flagHealthy(ctx, workload)
+		if deploy, ok := workload.(*appsv1.Deployment); ok {
+			d.recordHealthyRevision(ctx, deploy)
+		}
+		d.metrics.SetDeploymentStatus(workload, d.metrics.SlackChannel(ctx, workload.GetNamespace()), d.armed, metrics.OK)
+
+		return false
+	}
+
+	_, err := d.flagFailing(ctx, workload)
+	if err != nil {
+		log.Errorf("failed to add notification annotation to %s, err: %v", workload.GetName(), err)
+
+		return false
+	}
+
+	d.historizeDeployment(ctx, verdicts, workload)
+	d.metrics.SetDeploymentStatus(workload, d.metrics.SlackChannel(ctx, workload.GetNamespace()), d.armed, metrics.FAILING)
+
+	return true
+}
+
+// recordHealthyRevision annotates the deployment with its current revision and pod template hash, and marks its
+// replicaset as healthy, so that a later rollback can target it. Only revisions that are rolled out, and whose
+// replicaset is older than the resource age, are recorded, as pods failing shortly after becoming available are
+// common. A deployment without pods, e.g. one that has been downscaled, is not healthy however rolled out. The
+// change-cause is not considered, as babylon's is kept until the next change with a cause of its own, and the
+// revision rolled back to is as healthy as any other once rolled out.
+func (d *CoreCriteriaJudge) recordHealthyRevision(ctx context.Context, deploy *appsv1.Deployment) {
+	if deploy.Spec.Replicas != nil && *deploy.Spec.Replicas == 0 || deploy.Spec.Paused ||
+		!deployment.IsRolledOut(deploy) {
+		return
+	}
+
+	rs, err := deployment.GetReplicaSetsByDeployment(ctx, d.client, deploy)
+	if err != nil {
+		log.Errorf("Could not get replicasets for deployment %s: %v", deploy.Name, err)
+
+		return
+	}
+	current := deployment.GetNewReplicaSet(deploy, rs.Items)
+	if current == nil || d.isTooYoung(current, d.policies.For(deploy)) {
+		return
+	}
 
+	if _, ok := current.Annotations[config.HealthyAnnotation]; !ok {
+		patch := client.MergeFrom(current.DeepCopy())
+		current.Annotations[config.HealthyAnnotation] = time.Now().Format(time.RFC3339)
+		err = d.client.Patch(ctx, current, patch)
+		if err != nil {
+			log.Errorf("Failed to mark replicaset %s as healthy: %v", current.Name, err)
+
+			return
+		}
+	}
+
+	revision := current.Annotations[deployment.RevisionAnnotationKey]
+	hash := current.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	if deploy.Annotations[config.LastHealthyRevisionAnnotation] == revision &&
+		deploy.Annotations[config.LastHealthyHashAnnotation] == hash {
+		return
+	}
+
+	patch := client.MergeFrom(deploy.DeepCopy())
+	annotations := deploy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[config.LastHealthyRevisionAnnotation] = revision
+	annotations[config.LastHealthyHashAnnotation] = hash
+	deploy.SetAnnotations(annotations)
+	err = d.client.Patch(ctx, deploy, patch)
+	if err != nil {
+		log.Errorf("Failed to record healthy revision %s of deployment %s: %v", revision, deploy.Name, err)
+
+		return
+	}
+	log.Debugf("Recorded revision %s (%s) of deployment %s as healthy", revision, hash, deploy.Name)
+}
+
+func (d *CoreCriteriaJudge) isTooYoung(
+	workload metav1.Object,
+	policy *babylon_nais_io_v1alpha1.BabylonPolicySpec) bool {
+	resourceAge := d.resourceAge
+	if policy != nil && policy.ResourceAge != nil {
+		resourceAge = policy.ResourceAge.Duration
+	}
+
+	minDeploymentAge := time.Now().Add(-resourceAge)
+	if workload.GetCreationTimestamp().After(minDeploymentAge) {
+		log.Debugf("%s too young, skipping (%v)", workload.GetName(), workload.GetCreationTimestamp())
+
+		return true
+	}
+
+	return false
+}
+
+func (d *CoreCriteriaJudge) isFailing(ctx context.Context, deploy *appsv1.Deployment) (bool, []Verdict) {
+	policy := d.policies.For(deploy)
+	if d.isTooYoung(deploy, policy) {
 		return false, nil
 	}
 
@@ -89,164 +271,426 @@ func (d *CoreCriteriaJudge) isFailing(ctx context.Context, deploy *appsv1.Deploy
 
 	log.Tracef("Checking deployment: %s", deploy.Name)
 
+	subject := &Subject{Deployment: deploy, ReplicaSets: rs.Items, Policy: policy}
+	verdicts := d.rules.evaluate(DeploymentScope, subject)
+	for _, verdict := range verdicts {
+		d.incRuleActivations(deploy, verdict.Reason)
+	}
+	if verdicts = d.counted(deploy, verdicts); len(verdicts) > 0 {
+		log.Infof("Found errors in deployment %s", deploy.Name)
+
+		return true, verdicts
+	}
+
 	for j := range rs.Items {
-		if failing, reasons := d.judge(ctx, &rs.Items[j]); failing {
+		if failing, verdicts := d.judge(ctx, deploy, &rs.Items[j], policy); failing {
 			log.Infof("Found errors in deployment %s", deploy.Name)
 
-			return true, reasons
+			return true, verdicts
 		}
 	}
 
 	return false, nil
 }
 
-func (d *CoreCriteriaJudge) judge(ctx context.Context, set *appsv1.ReplicaSet) (bool, []string) {
-	initPodsFailing, initReasons := d.initPodsFailing(ctx, set)
-	if podsFailing, podReasons := d.allPodsFailingInReplicaset(ctx, set); podsFailing || initPodsFailing {
-		return true, append(podReasons, initReasons)
+func (d *CoreCriteriaJudge) isStatefulSetFailing(ctx context.Context, sts *appsv1.StatefulSet) (bool, []Verdict) {
+	policy := d.policies.For(sts)
+	if d.isTooYoung(sts, policy) {
+		return false, nil
 	}
 
-	return false, nil
-}
+	revisions, err := statefulset.GetControllerRevisionsByStatefulSet(ctx, d.client, sts)
+	if err != nil {
+		log.Errorf("Could not get controller revisions for statefulset %s: %v", sts.Name, err)
+
+		return false, nil
+	}
 
-func (d *CoreCriteriaJudge) flagFailingDeployment(ctx context.Context, deployment *appsv1.Deployment) (bool, error) {
-	if deployment.Annotations[config.FailureDetectedAnnotation] == "" {
-		patch := client.MergeFrom(deployment.DeepCopy())
-		deployment.Annotations[config.FailureDetectedAnnotation] = time.Now().Format(time.RFC3339)
-		err := d.client.Patch(ctx, deployment, patch)
+	log.Tracef("Checking statefulset: %s", sts.Name)
+
+	for j := range revisions {
+		pods, err := statefulset.GetPodsFromControllerRevision(ctx, d.client, sts, &revisions[j])
 		if err != nil {
-			return false, fmt.Errorf("%w", err)
+			log.Errorf("finding pods for controller revision %s failed", revisions[j].Name)
+
+			continue
+		}
+		if len(pods) == 0 {
+			continue
 		}
 
-		log.Infof("Marking deployment %s as failing", deployment.Name)
+		subject := &Subject{StatefulSet: sts, Revision: &revisions[j], Pods: pods, Policy: policy}
+		if failing, verdicts := d.judgePods(sts, subject); failing {
+			log.Infof("Found errors in statefulset %s", sts.Name)
 
-		return true, nil
+			return true, verdicts
+		}
 	}
 
 	return false, nil
 }
 
-func (d *CoreCriteriaJudge) flagHealthyDeployment(ctx context.Context, deploy *appsv1.Deployment) {
-	if deploy.Annotations[config.FailureDetectedAnnotation] != "" {
-		patch := client.MergeFrom(deploy.DeepCopy())
-		delete(deploy.Annotations, config.FailureDetectedAnnotation)
-		err := d.client.Patch(ctx, deploy, patch)
-		if err != nil {
-			log.Errorf("Error removing %s annotation from deployment %s since it is healthy. Error: %v",
-				config.FailureDetectedAnnotation, deploy.Name, err)
-		} else {
-			log.Infof("Removed %s annotation from deployment %s since it is healthy",
-				config.FailureDetectedAnnotation, deploy.Name)
-		}
-	}
+// cronJobPodReasons are the pod failures that fail a cronjob at once, as they will not resolve by the next run.
+var cronJobPodReasons = []string{
+	deployment.ImagePullBackOff, deployment.CreateContainerConfigError, deployment.CreateContainerError,
+	deployment.InvalidImageName, deployment.RunContainerError, deployment.ContainerCannotRun,
 }
 
-func (d *CoreCriteriaJudge) allPodsFailingInReplicaset(ctx context.Context, set *appsv1.ReplicaSet) (bool, []string) {
-	if *set.Spec.Replicas == 0 {
+func (d *CoreCriteriaJudge) isCronJobFailing(ctx context.Context, cronJob *batchv1.CronJob) (bool, []Verdict) {
+	policy := d.policies.For(cronJob)
+	if d.isTooYoung(cronJob, policy) {
 		return false, nil
 	}
 
-	pods, err := deployment.GetPodsFromReplicaSet(ctx, d.client, set)
+	jobs, err := cronjob.GetJobsByCronJob(ctx, d.client, cronJob)
 	if err != nil {
-		log.Errorf("finding pods for replicaSet %s failed", set.Name)
+		log.Errorf("Could not get jobs for cronjob %s: %v", cronJob.Name, err)
 
 		return false, nil
 	}
 
-	failedPods := 0
-	var reasons []string
-	for i := range pods.Items {
-		if fail, reason := d.shouldPodBeDeleted(&pods.Items[i]); fail {
-			failedPods++
-			d.metrics.IncRuleActivations(&pods.Items[i], reason)
-			reasons = append(reasons, reason)
+	log.Tracef("Checking cronjob: %s", cronJob.Name)
+
+	threshold := cronjob.CapFailedJobsThreshold(cronJob, d.failedJobs)
+	if failed, reason := cronjob.CountConsecutiveFailedJobs(jobs); failed >= threshold {
+		log.Infof("Found %d consecutive failed jobs for cronjob %s", failed, cronJob.Name)
+		d.incRuleActivations(cronJob, deployment.JobFailed)
+
+		return true, []Verdict{{
+			Reason:  deployment.JobFailed,
+			Message: fmt.Sprintf("%d consecutive jobs failed, most recently due to %s", failed, reason),
+			Details: map[string]string{"failed_jobs": strconv.Itoa(failed)},
+		}}
+	}
+
+	// only the most recent job tells whether the next run will fail, older jobs are kept for history
+	if len(jobs) == 0 {
+		return false, nil
+	}
+	job := &jobs[0]
+	pods, err := cronjob.GetPodsFromJob(ctx, d.client, job)
+	if err != nil {
+		log.Errorf("finding pods for job %s failed", job.Name)
+
+		return false, nil
+	}
+
+	subject := &Subject{Job: job, Pods: d.sidecars.appPods(pods), Policy: policy}
+	verdicts := d.rules.evaluate(ReplicaSetScope, subject)
+	for i := range pods {
+		if verdict := d.evaluatePod(&Subject{Job: job, Pods: pods, Pod: &pods[i], Policy: policy}); verdict != nil {
+			verdicts = append(verdicts, *verdict)
 		}
 	}
 
-	if failedPods > 0 {
-		log.Debugf("%d/%d failing pods in replicaset %s due to %v", failedPods, len(pods.Items), set.Name, reasons)
+	var failures []Verdict
+	for _, verdict := range verdicts {
+		if slices.Contains(cronJobPodReasons, verdict.Reason) {
+			d.incRuleActivations(cronJob, verdict.Reason)
+			failures = append(failures, verdict)
+		}
+	}
+	if len(failures) > 0 {
+		log.Infof("Found errors in cronjob %s", cronJob.Name)
+
+		return true, failures
 	}
 
-	return failedPods == len(pods.Items), reasons
+	return false, nil
 }
 
-func (d *CoreCriteriaJudge) initPodsFailing(ctx context.Context, set *appsv1.ReplicaSet) (bool, string) {
+func (d *CoreCriteriaJudge) judge(
+	ctx context.Context,
+	deploy *appsv1.Deployment,
+	set *appsv1.ReplicaSet,
+	policy *babylon_nais_io_v1alpha1.BabylonPolicySpec) (bool, []Verdict) {
 	pods, err := deployment.GetPodsFromReplicaSet(ctx, d.client, set)
 	if err != nil {
-		return false, ""
+		log.Errorf("finding pods for replicaSet %s failed", set.Name)
+
+		return false, nil
+	}
+
+	return d.judgePods(deploy, &Subject{Deployment: deploy, ReplicaSet: set, Pods: pods.Items, Policy: policy})
+}
+
+// judgePods evaluates the pods of a single replicaset or statefulset revision.
+func (d *CoreCriteriaJudge) judgePods(workload metav1.Object, subject *Subject) (bool, []Verdict) {
+	podsFailing, ratio, verdicts := d.podsFailingInReplicaset(subject, d.failureThresholdOf(workload))
+	if subject.isCurrent() {
+		d.metrics.SetFailingPodRatio(workload, ratio)
+	}
+	setSubject := *subject
+	setSubject.Pods = d.sidecars.appPods(subject.Pods)
+	setVerdicts := d.rules.evaluate(ReplicaSetScope, &setSubject)
+	for _, verdict := range setVerdicts {
+		d.incRuleActivations(workload, verdict.Reason)
 	}
+	setVerdicts = d.counted(workload, setVerdicts)
 
-	for i := range pods.Items {
-		if failing, reason := deployment.IsInitContainerFailed(
-			d.restartThreshold,
-			pods.Items[i].Status.InitContainerStatuses); failing {
-			log.Infof("Init container failing for rs %s due to %s", set.Name, reason)
+	if podsFailing || len(setVerdicts) > 0 {
+		return true, append(verdicts, setVerdicts...)
+	}
+
+	return false, nil
+}
 
-			return true, reason
+func (d *CoreCriteriaJudge) flagFailing(ctx context.Context, workload client.Object) (bool, error) {
+	if workload.GetAnnotations()[config.FailureDetectedAnnotation] == "" {
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		annotations := workload.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[config.FailureDetectedAnnotation] = time.Now().Format(time.RFC3339)
+		workload.SetAnnotations(annotations)
+		err := d.client.Patch(ctx, workload, patch)
+		if err != nil {
+			return false, fmt.Errorf("%w", err)
 		}
+
+		log.Infof("Marking %s as failing", workload.GetName())
+
+		return true, nil
 	}
 
-	return false, ""
+	return false, nil
 }
 
-func (d *CoreCriteriaJudge) shouldPodBeDeleted(pod *v1.Pod) (bool, string) {
-	switch {
-	case pod.Status.Phase == v1.PodRunning:
-		log.Tracef("Pod: %s running", pod.Name)
-		if deployment.IsContainerCrashLoopBackOff(d.restartThreshold, pod.Status.ContainerStatuses) {
-			return true, deployment.CrashLoopBackOff
+func (d *CoreCriteriaJudge) flagHealthy(ctx context.Context, workload client.Object) {
+	if workload.GetAnnotations()[config.FailureDetectedAnnotation] != "" {
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		annotations := workload.GetAnnotations()
+		delete(annotations, config.FailureDetectedAnnotation)
+		workload.SetAnnotations(annotations)
+		err := d.client.Patch(ctx, workload, patch)
+		if err != nil {
+			log.Errorf("Error removing %s annotation from %s since it is healthy. Error: %v",
+				config.FailureDetectedAnnotation, workload.GetName(), err)
+		} else {
+			log.Infof("Removed %s annotation from %s since it is healthy",
+				config.FailureDetectedAnnotation, workload.GetName())
 		}
+	}
+}
 
-		return false, ""
-	case pod.Status.Phase == v1.PodSucceeded:
-		log.Tracef("Pod: %s succeeded", pod.Name)
+// failureThreshold decides how many pods of a replicaset, or a statefulset revision, must be failing for it to
+// be considered failing.
+type failureThreshold struct {
+	ratio   float64
+	minPods int
+}
 
-		return false, ""
-	case pod.Status.Phase == v1.PodPending:
-		log.Tracef("Pod: %s pending", pod.Name)
-		if deployment.IsContainerImageCheckFail(pod.Status.ContainerStatuses) {
-			return true, deployment.ImagePullBackOff
+// failureThresholdOf returns the configured threshold, overridden by the workload's annotations if valid.
+func (d *CoreCriteriaJudge) failureThresholdOf(workload metav1.Object) failureThreshold {
+	threshold := d.threshold
+	annotations := workload.GetAnnotations()
+
+	if value, ok := annotations[config.FailureRatioAnnotation]; ok {
+		ratio, err := config.ParseFailureRatio(value)
+		if err != nil {
+			log.Warnf("%s has invalid %s annotation, using %v: %v",
+				workload.GetName(), config.FailureRatioAnnotation, threshold.ratio, err)
+		} else {
+			threshold.ratio = ratio
 		}
-		if deployment.IsCreateContainerConfigError(pod.Status.ContainerStatuses) {
-			return true, deployment.CreateContainerConfigError
+	}
+
+	if value, ok := annotations[config.MinFailingPodsAnnotation]; ok {
+		minPods, err := strconv.Atoi(value)
+		if err != nil || minPods < 1 {
+			log.Warnf("%s has invalid %s annotation %q, using %d",
+				workload.GetName(), config.MinFailingPodsAnnotation, value, threshold.minPods)
+		} else {
+			threshold.minPods = minPods
 		}
+	}
 
-		return false, ""
-	case pod.Status.Phase == v1.PodFailed:
-		log.Tracef("Pod: %s failed", pod.Name)
+	return threshold
+}
 
-		return false, "" // should be true?
-	case pod.Status.Phase == v1.PodUnknown:
-		log.Tracef("Pod: %s unknown", pod.Name)
+// podsFailingInReplicaset decides whether the pods of a replicaset, or a statefulset revision, are failing, and
+// returns the ratio of failing pods.
+func (d *CoreCriteriaJudge) podsFailingInReplicaset(
+	subject *Subject,
+	threshold failureThreshold) (bool, float64, []Verdict) {
+	if subject.ReplicaSet != nil && *subject.ReplicaSet.Spec.Replicas == 0 {
+		return false, 0, nil
+	}
 
-		return false, ""
-	default:
-		return false, ""
+	failedPods := 0
+	replacedPods := 0
+	var verdicts, reported []Verdict
+	for i := range subject.Pods {
+		pod := &subject.Pods[i]
+		verdict := d.evaluatePod(&Subject{
+			Deployment:  subject.Deployment,
+			ReplicaSet:  subject.ReplicaSet,
+			StatefulSet: subject.StatefulSet,
+			Revision:    subject.Revision,
+			Pods:        subject.Pods,
+			Pod:         pod,
+			Policy:      subject.Policy,
+		})
+		switch {
+		case verdict == nil:
+			continue
+		case verdict.ReportOnly:
+			// reported pods in phase Failed, e.g. evicted ones, are leftovers that have been replaced, while other
+			// reported pods, e.g. those with only a failing sidecar, are still serving and count as healthy
+			if pod.Status.Phase == v1.PodFailed {
+				replacedPods++
+			}
+			reported = append(reported, *verdict)
+		default:
+			failedPods++
+			verdicts = append(verdicts, *verdict)
+		}
+		d.incRuleActivations(pod, verdict.Reason)
+	}
+
+	if len(reported) > 0 {
+		log.Infof("%d pods in replicaset %s reported, but not counted as failing, due to %v",
+			len(reported), subject.name(), reasonsOf(reported))
 	}
+
+	countedPods := len(subject.Pods) - replacedPods
+	if countedPods == 0 {
+		return false, 0, verdicts
+	}
+
+	ratio := float64(failedPods) / float64(countedPods)
+	if failedPods > 0 {
+		log.Debugf("%d/%d failing pods in replicaset %s due to %v",
+			failedPods, countedPods, subject.name(), reasonsOf(verdicts))
+	}
+
+	for i := range verdicts {
+		verdicts[i].Details = withDetail(verdicts[i].Details, "failing_ratio", strconv.FormatFloat(ratio, 'f', 2, 64))
+		verdicts[i].Details["failing_pods"] = fmt.Sprintf("%d/%d", failedPods, countedPods)
+	}
+
+	return failedPods >= threshold.minPods && ratio >= threshold.ratio, ratio, verdicts
 }
 
-func (d *CoreCriteriaJudge) warnIfMultipleUniqueReasons(deploy *appsv1.Deployment, reasons []string) {
+// evaluatePod returns the verdict of the first enabled pod rule that fires for the pod's app containers, if any.
+// Otherwise, failing sidecars are reported as infrastructure failures according to the sidecar policy.
+func (d *CoreCriteriaJudge) evaluatePod(subject *Subject) *Verdict {
+	app, infra := d.sidecars.split(subject.Pod)
+	appSubject := *subject
+	appSubject.Pod = app
+	if verdict := d.evaluatePodRules(&appSubject); verdict != nil {
+		return verdict
+	}
+
+	if infra == nil || d.sidecars.policy == config.PolicyIgnore {
+		return nil
+	}
+
+	infraSubject := *subject
+	infraSubject.Pod = infra
+	verdict := d.evaluatePodRules(&infraSubject)
+	if verdict == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(infra.Status.ContainerStatuses))
+	for _, status := range infra.Status.ContainerStatuses {
+		names = append(names, status.Name)
+	}
+	log.Debugf("Pod: %s sidecars %v failing due to %s", subject.Pod.Name, names, verdict.Reason)
+
+	return &Verdict{
+		Rule:       verdict.Rule,
+		Reason:     deployment.Infrastructure,
+		Message:    fmt.Sprintf("sidecars %v failing due to %s: %s", names, verdict.Reason, verdict.Message),
+		Details:    withDetail(verdict.Details, "sidecar_reason", verdict.Reason),
+		ReportOnly: d.sidecars.policy == config.PolicyReport,
+	}
+}
+
+func (d *CoreCriteriaJudge) evaluatePodRules(subject *Subject) *Verdict {
+	for _, rule := range d.rules.rulesFor(PodScope, subject.Policy) {
+		if verdict := rule.Evaluate(subject); verdict != nil {
+			verdict.Rule = rule.Name()
+
+			return verdict
+		}
+	}
+
+	return nil
+}
+
+func (d *CoreCriteriaJudge) warnIfMultipleUniqueReasons(workload metav1.Object, verdicts []Verdict) {
 	m := make(map[string]struct{})
 
-	for _, reason := range reasons {
-		if reason == "" {
+	for _, verdict := range verdicts {
+		if verdict.Reason == "" {
 			continue
 		}
-		m[reason] = struct{}{}
+		m[verdict.Reason] = struct{}{}
 	}
 
 	if len(m) > 1 {
-		log.Warnf("Deployment %s has multiple distinct reasons for failing: %v", deploy.Name, reasons)
+		log.Warnf("%s has multiple distinct reasons for failing: %v", workload.GetName(), reasonsOf(verdicts))
+	}
+}
+
+// incRuleActivations counts a rule firing for the object, unless judging on change.
+func (d *CoreCriteriaJudge) incRuleActivations(object metav1.Object, reason string) {
+	if d.onChange {
+		return
 	}
+
+	d.metrics.IncRuleActivations(object, reason)
 }
 
-func (d *CoreCriteriaJudge) historizeDeployment(ctx context.Context, reasons []string, deploy *appsv1.Deployment) {
-	if len(reasons) > 0 {
-		d.warnIfMultipleUniqueReasons(deploy, reasons)
+func (d *CoreCriteriaJudge) historizeDeployment(ctx context.Context, verdicts []Verdict, workload metav1.Object) {
+	if d.onChange {
+		return
+	}
+
+	if len(verdicts) > 0 {
+		d.warnIfMultipleUniqueReasons(workload, verdicts)
 		d.history.HistorizeDeploymentFailing(
-			reasons[0], deployment.SafeGetLabel(deploy, "team"),
-			d.metrics.SlackChannel(ctx, deploy.Namespace), deploy.Name)
+			verdicts[0].Reason, verdicts[0].Message, deployment.SafeGetLabel(workload, "team"),
+			d.metrics.SlackChannel(ctx, workload.GetNamespace()), workload.GetName(), verdicts[0].Details)
 	} else {
-		log.Warnf("Deployment %s marked as failing but without failing reasons: %v", deploy.Name, reasons)
+		log.Warnf("%s marked as failing but without failing reasons", workload.GetName())
+	}
+}
+
+// counted logs and drops report-only verdicts, returning the ones that mark the workload as failing.
+func (d *CoreCriteriaJudge) counted(workload metav1.Object, verdicts []Verdict) []Verdict {
+	var counted []Verdict
+	for _, verdict := range verdicts {
+		if verdict.ReportOnly {
+			log.Infof("%s reported, but not counted as failing, due to %s", workload.GetName(), verdict.Reason)
+
+			continue
+		}
+		counted = append(counted, verdict)
+	}
+
+	return counted
+}
+
+// withDetail returns a copy of details with the key set, leaving the original untouched as rules may share it.
+func withDetail(details map[string]string, key, value string) map[string]string {
+	copied := make(map[string]string, len(details)+1)
+	for k, v := range details {
+		copied[k] = v
+	}
+	copied[key] = value
+
+	return copied
+}
+
+func reasonsOf(verdicts []Verdict) []string {
+	reasons := make([]string, 0, len(verdicts))
+	for _, verdict := range verdicts {
+		reasons = append(reasons, verdict.Reason)
 	}
+
+	return reasons
 }
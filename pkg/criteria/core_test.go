@@ -1,11 +1,27 @@
 package criteria
 
 import (
+	"context"
+	"fmt"
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
 	"github.com/nais/babylon/pkg/config"
 	"github.com/nais/babylon/pkg/deployment"
+	"github.com/nais/babylon/pkg/events"
+	"github.com/nais/babylon/pkg/metrics"
+	"github.com/nais/babylon/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func makePodWithState(meta metav1.ObjectMeta, status v1.PodStatus) v1.Pod {
@@ -74,10 +90,14 @@ func TestContainersInCrashLoopBackOff(t *testing.T) {
 		t.Run(tt.Name, func(t *testing.T) {
 			t.Parallel()
 			cfg := config.DefaultConfig()
+			cfg.MaxRestartsPerWindow = 0
 			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
 			pod := createPod(tt.State, tt.RestartCount)
 			cfg.RestartThreshold = tt.RestartThreshold
-			res, reason := judge.shouldPodBeDeleted(&pod)
+			res, reason := false, ""
+			if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+				res, reason = true, verdict.Reason
+			}
 
 			if res != tt.Expected || reason != tt.ExpectedReason {
 				t.Fatalf("Expected pod to be marked for deletion: %v, with reason %v, got result: %v, with reason %v, pod: %+v", tt.Expected, tt.ExpectedReason, res, reason, pod)
@@ -87,6 +107,329 @@ func TestContainersInCrashLoopBackOff(t *testing.T) {
 
 }
 
+func TestContainersRestartRate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	createPod := func(startedAgo time.Duration, restartCount int32, init bool) *v1.Pod {
+		statuses := []v1.ContainerStatus{{
+			Name:         "app",
+			State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: deployment.CrashLoopBackOff}},
+			RestartCount: restartCount,
+		}}
+		pod := makePodWithState(metav1.ObjectMeta{Name: "failingpod", UID: "pod-uid"}, v1.PodStatus{
+			Phase:             v1.PodRunning,
+			ContainerStatuses: statuses,
+		})
+		// a pod without a start time has not been observed by the kubelet yet
+		if startedAgo > 0 {
+			pod.Status.StartTime = &metav1.Time{Time: now.Add(-startedAgo)}
+		}
+		if init {
+			pod.Status.Phase = v1.PodPending
+			pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses = statuses, nil
+		}
+
+		return &pod
+	}
+
+	type observation struct {
+		After        time.Duration
+		RestartCount int32
+		Expected     bool
+	}
+	cases := []struct {
+		Name             string
+		StartedAgo       time.Duration
+		Init             bool
+		RestartThreshold *int32
+		Observations     []observation
+	}{
+		{
+			Name:       "Restarts past the restart threshold over months",
+			StartedAgo: 180 * 24 * time.Hour,
+			Observations: []observation{
+				{After: 0, RestartCount: 2000, Expected: true},
+				{After: 15 * time.Minute, RestartCount: 2000, Expected: true},
+			},
+		},
+		{
+			Name:             "Restarts past the restart threshold of the policy",
+			StartedAgo:       90 * 24 * time.Hour,
+			RestartThreshold: utils.Int32ptr(100),
+			Observations: []observation{
+				{After: 0, RestartCount: 150, Expected: true},
+			},
+		},
+		{
+			Name: "Frequent restarts of a pod without a start time",
+			Observations: []observation{
+				{After: 0, RestartCount: 20, Expected: false},
+				{After: 15 * time.Minute, RestartCount: 23, Expected: false},
+				{After: 30 * time.Minute, RestartCount: 26, Expected: true},
+			},
+		},
+		{
+			Name:       "Frequent restarts of an init container",
+			StartedAgo: 2 * time.Hour,
+			Init:       true,
+			Observations: []observation{
+				{After: 0, RestartCount: 20, Expected: false},
+				{After: 15 * time.Minute, RestartCount: 23, Expected: true},
+			},
+		},
+		{
+			Name:       "Few restarts over a long time",
+			StartedAgo: 90 * 24 * time.Hour,
+			Observations: []observation{
+				{After: 0, RestartCount: 150, Expected: false},
+				{After: 15 * time.Minute, RestartCount: 150, Expected: false},
+			},
+		},
+		{
+			Name:       "Frequent restarts for consecutive observations",
+			StartedAgo: 10 * time.Hour,
+			Observations: []observation{
+				{After: 0, RestartCount: 120, Expected: false},
+				{After: 15 * time.Minute, RestartCount: 123, Expected: true},
+			},
+		},
+		{
+			Name:       "Restarts between observations seconds apart",
+			StartedAgo: 90 * 24 * time.Hour,
+			Observations: []observation{
+				{After: 0, RestartCount: 120, Expected: false},
+				{After: 5 * time.Second, RestartCount: 121, Expected: false},
+				{After: 10 * time.Second, RestartCount: 122, Expected: false},
+				{After: 15 * time.Minute, RestartCount: 122, Expected: false},
+			},
+		},
+		{
+			Name:       "Restarts stop between observations",
+			StartedAgo: 10 * time.Hour,
+			Observations: []observation{
+				{After: 0, RestartCount: 120, Expected: false},
+				{After: 15 * time.Minute, RestartCount: 120, Expected: false},
+				{After: 30 * time.Minute, RestartCount: 123, Expected: false},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			restarts := newRestartTracker(time.Hour, 15*time.Minute, 6)
+			rule := &crashLoopBackOffRule{restartThreshold: 1000, restarts: restarts, observations: 2}
+			policy := &babylon_nais_io_v1alpha1.BabylonPolicySpec{RestartThreshold: tt.RestartThreshold}
+			for i, o := range tt.Observations {
+				restarts.now = func() time.Time { return now.Add(o.After) }
+				verdict := rule.Evaluate(&Subject{
+					Pod:    createPod(tt.StartedAgo, o.RestartCount, tt.Init),
+					Policy: policy,
+				})
+				if (verdict != nil) != o.Expected {
+					t.Fatalf("Expected observation %d to be failing: %v, got %+v", i, o.Expected, verdict)
+				}
+			}
+		})
+	}
+}
+
+func TestSidecarContainers(t *testing.T) {
+	t.Parallel()
+
+	crashing := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: deployment.CrashLoopBackOff}}
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+
+	waiting := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"}}
+	restartPolicyAlways := func(name string) []v1.Container {
+		always := v1.ContainerRestartPolicyAlways
+
+		return []v1.Container{{Name: name, RestartPolicy: &always}}
+	}
+
+	cases := []struct {
+		Name               string
+		Phase              v1.PodPhase
+		InitContainerSpecs []v1.Container
+		Containers         []v1.ContainerStatus
+		InitContainers     []v1.ContainerStatus
+		Policy             string
+		ExpectedReason     string
+		ExpectedReportOnly bool
+	}{
+		{
+			Name: "Crashing sidecar is reported as infrastructure",
+			Containers: []v1.ContainerStatus{
+				{Name: "app", State: running},
+				{Name: "linkerd-proxy", State: crashing, RestartCount: 1000},
+			},
+			Policy:             config.PolicyReport,
+			ExpectedReason:     deployment.Infrastructure,
+			ExpectedReportOnly: true,
+		},
+		{
+			Name: "Crashing sidecar does not hide crashing app",
+			Containers: []v1.ContainerStatus{
+				{Name: "app", State: crashing, RestartCount: 1000},
+				{Name: "linkerd-proxy", State: crashing, RestartCount: 1000},
+			},
+			Policy:         config.PolicyReport,
+			ExpectedReason: deployment.CrashLoopBackOff,
+		},
+		{
+			Name: "Crashing sidecar is ignored",
+			Containers: []v1.ContainerStatus{
+				{Name: "app", State: running},
+				{Name: "vault-agent-init", State: crashing, RestartCount: 1000},
+			},
+			Policy:         config.PolicyIgnore,
+			ExpectedReason: "",
+		},
+		{
+			Name:       "Crashing native sidecar is counted as infrastructure",
+			Containers: []v1.ContainerStatus{{Name: "app", State: running}},
+			InitContainers: []v1.ContainerStatus{
+				{Name: "setup", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed"}}},
+				{Name: "proxy", State: crashing, RestartCount: 1000},
+			},
+			Policy:         config.PolicyCount,
+			ExpectedReason: deployment.Infrastructure,
+		},
+		{
+			Name:               "Native sidecar crashing before the app has started is counted as infrastructure",
+			Phase:              v1.PodPending,
+			InitContainerSpecs: restartPolicyAlways("proxy"),
+			Containers:         []v1.ContainerStatus{{Name: "app", State: waiting}},
+			InitContainers:     []v1.ContainerStatus{{Name: "proxy", State: crashing, RestartCount: 1000}},
+			Policy:             config.PolicyCount,
+			ExpectedReason:     deployment.Infrastructure,
+		},
+		{
+			Name:           "Sidecar init container crashing before the app has started is matched by name",
+			Phase:          v1.PodPending,
+			Containers:     []v1.ContainerStatus{{Name: "app", State: waiting}},
+			InitContainers: []v1.ContainerStatus{{Name: "linkerd-proxy", State: crashing, RestartCount: 1000}},
+			Policy:         config.PolicyCount,
+			ExpectedReason: deployment.Infrastructure,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.DefaultConfig()
+			cfg.SidecarPolicy = tt.Policy
+			cfg.MaxRestartsPerWindow = 0
+			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+			phase := tt.Phase
+			if phase == "" {
+				phase = v1.PodRunning
+			}
+			pod := makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+				Phase:                 phase,
+				ContainerStatuses:     tt.Containers,
+				InitContainerStatuses: tt.InitContainers,
+			})
+			pod.Spec.InitContainers = tt.InitContainerSpecs
+
+			reason, reportOnly := "", false
+			if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+				reason, reportOnly = verdict.Reason, verdict.ReportOnly
+			}
+			if reason != tt.ExpectedReason || reportOnly != tt.ExpectedReportOnly {
+				t.Fatalf("Expected reason %q (report only: %v), got %q (report only: %v)",
+					tt.ExpectedReason, tt.ExpectedReportOnly, reason, reportOnly)
+			}
+
+			for _, app := range judge.sidecars.appPods([]v1.Pod{pod}) {
+				if failing, _ := deployment.IsInitContainerFailed(cfg.RestartThreshold,
+					app.Status.InitContainerStatuses); failing {
+					t.Fatalf("Expected sidecars to be excluded from init containers, got %+v",
+						app.Status.InitContainerStatuses)
+				}
+			}
+		})
+	}
+}
+
+func TestEventRules(t *testing.T) {
+	t.Parallel()
+
+	createEvent := func(eventType, reason string, count int32, ago time.Duration) *v1.Event {
+		return &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "event", UID: "event-uid"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "pod", UID: "pod-uid"},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        "Unable to attach or mount volumes",
+			Count:          count,
+			LastTimestamp:  metav1.NewTime(time.Now().Add(-ago)),
+		}
+	}
+
+	cases := []struct {
+		Name           string
+		Event          *v1.Event
+		ExpectedReason string
+	}{
+		{
+			Name:           "Repeated FailedMount",
+			Event:          createEvent(v1.EventTypeWarning, events.FailedMount, 12, time.Minute),
+			ExpectedReason: events.FailedMount,
+		},
+		{
+			Name:  "Too few occurrences",
+			Event: createEvent(v1.EventTypeWarning, events.FailedMount, 3, time.Minute),
+		},
+		{
+			Name:  "Normal events are disregarded",
+			Event: createEvent(v1.EventTypeNormal, events.FailedMount, 12, time.Minute),
+		},
+		{
+			Name:  "Old events are disregarded",
+			Event: createEvent(v1.EventTypeWarning, events.FailedMount, 12, 2*time.Hour),
+		},
+		{
+			Name:  "Unwatched reason",
+			Event: createEvent(v1.EventTypeWarning, "FailedScheduling", 12, time.Minute),
+		},
+		{
+			Name:  "BackOff is not watched by default",
+			Event: createEvent(v1.EventTypeWarning, events.BackOff, 12, time.Minute),
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.DefaultConfig()
+			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+			watcher := events.NewWatcher(cfg.EventReasons, cfg.EventMaxAge)
+			judge.Rules().Register(NewEventRules(watcher, cfg.EventThreshold)...)
+			watcher.OnAdd(tt.Event, false)
+
+			pod := makePodWithState(metav1.ObjectMeta{Name: "pod", UID: "pod-uid"}, v1.PodStatus{Phase: v1.PodPending})
+			reason := ""
+			if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+				reason = verdict.Reason
+				if verdict.Details["event_count"] != strconv.Itoa(int(tt.Event.Count)) {
+					t.Fatalf("Expected event count in verdict details, got %+v", verdict.Details)
+				}
+			}
+			if reason != tt.ExpectedReason {
+				t.Fatalf("Expected reason %q, got %q", tt.ExpectedReason, reason)
+			}
+		})
+	}
+}
+
 func TestContainersWithImageCheckFailed(t *testing.T) {
 	t.Parallel()
 	createPod := func(state v1.ContainerState, phase v1.PodPhase) v1.Pod {
@@ -132,7 +475,10 @@ func TestContainersWithImageCheckFailed(t *testing.T) {
 			pod := createPod(tt.State, tt.Phase)
 			cfg := config.DefaultConfig()
 			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
-			res, reason := judge.shouldPodBeDeleted(&pod)
+			res, reason := false, ""
+			if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+				res, reason = true, verdict.Reason
+			}
 
 			if res != tt.Expected || reason != tt.ExpectedReason {
 				t.Fatalf("Expected pod to be marked for deletion: %v, with reason %v, got result: %v, with reason %v, pod: %+v", tt.Expected, tt.ExpectedReason, res, reason, pod)
@@ -140,3 +486,924 @@ func TestContainersWithImageCheckFailed(t *testing.T) {
 		})
 	}
 }
+
+func TestContainersOOMKilled(t *testing.T) {
+	t.Parallel()
+
+	pod := makePodWithState(metav1.ObjectMeta{Name: "failingpod"}, v1.PodStatus{
+		Phase: v1.PodRunning,
+		ContainerStatuses: []v1.ContainerStatus{{
+			Name:         "app",
+			RestartCount: 1000,
+			State: v1.ContainerState{
+				Waiting: &v1.ContainerStateWaiting{Reason: deployment.CrashLoopBackOff},
+			},
+			LastTerminationState: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{Reason: deployment.OOMKilled},
+			},
+		}},
+	})
+	pod.Spec.Containers = []v1.Container{{
+		Name: "app",
+		Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+		},
+	}}
+
+	cfg := config.DefaultConfig()
+	judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+	verdict := judge.evaluatePod(&Subject{Pod: &pod})
+
+	if verdict == nil || verdict.Reason != deployment.OOMKilled {
+		t.Fatalf("Expected pod to be failing with reason %s, got %+v", deployment.OOMKilled, verdict)
+	}
+	if verdict.Details["memory_limit"] != "256Mi" || verdict.Details["restart_count"] != "1000" {
+		t.Fatalf("Expected memory limit and restart count in verdict details, got %+v", verdict.Details)
+	}
+
+	// restarting too often, long before the restart threshold, is OOMKilled rather than crash-loop-back-off
+	now := time.Now()
+	for _, rule := range judge.rules.rules {
+		if oomKilled, ok := rule.(*oomKilledRule); ok {
+			oomKilled.restarts.now = func() time.Time { return now }
+		}
+	}
+	pod.UID = "pod-uid"
+	pod.Status.StartTime = &metav1.Time{Time: now.Add(-2 * time.Hour)}
+	pod.Status.ContainerStatuses[0].RestartCount = 40
+	for i := 0; i < cfg.RestartRateObservations; i++ {
+		now = now.Add(cfg.TickRate)
+		verdict = judge.evaluatePod(&Subject{Pod: &pod})
+		pod.Status.ContainerStatuses[0].RestartCount += 3
+	}
+	if verdict == nil || verdict.Reason != deployment.OOMKilled || verdict.Rule != OOMKilledRuleName {
+		t.Fatalf("Expected frequently restarting pod to be failing with reason %s, got %+v", deployment.OOMKilled,
+			verdict)
+	}
+}
+
+// builderIndexer registers field indexes on a fake client builder, as the fake client only lists by indexed fields.
+type builderIndexer struct {
+	builder *fake.ClientBuilder
+}
+
+func (b builderIndexer) IndexField(
+	_ context.Context,
+	obj client.Object,
+	field string,
+	extract client.IndexerFunc) error {
+	b.builder.WithIndex(obj, field, extract)
+
+	return nil
+}
+
+// newFakeClientBuilder returns a fake client builder with the field indexes registered by the manager.
+func newFakeClientBuilder() *fake.ClientBuilder {
+	builder := fake.NewClientBuilder()
+	_ = deployment.IndexOwners(context.Background(), builderIndexer{builder: builder})
+
+	return builder
+}
+
+func newTestMetrics() *metrics.Metrics {
+	return &metrics.Metrics{
+		RuleActivations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "babylon_rule_activations_total",
+		}, []string{"deployment", "namespace", "affected_team", "reason"}),
+		DeploymentCleanup: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "babylon_deployment_cleanup_total",
+		}, []string{"deployment", "namespace", "affected_team", "dry_run", "reason", "slack_channel"}),
+		FailingPodRatio: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "babylon_failing_pod_ratio",
+		}, []string{"deployment", "namespace", "affected_team"}),
+	}
+}
+
+func TestFailedPodsInReplicaSet(t *testing.T) {
+	t.Parallel()
+
+	createPod := func(phase v1.PodPhase, reason string) v1.Pod {
+		return makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{Phase: phase, Reason: reason})
+	}
+
+	cases := []struct {
+		Name           string
+		Pods           []v1.Pod
+		Expected       bool
+		ExpectedReason string
+	}{
+		{
+			Name: "Evicted pods alongside a running pod",
+			Pods: []v1.Pod{
+				createPod(v1.PodFailed, deployment.Evicted),
+				createPod(v1.PodFailed, deployment.Evicted),
+				createPod(v1.PodRunning, ""),
+			},
+			Expected: false,
+		},
+		{
+			Name: "Evicted pod storm never fails on its own",
+			Pods: []v1.Pod{
+				createPod(v1.PodFailed, deployment.Evicted),
+				createPod(v1.PodFailed, deployment.Evicted),
+			},
+			Expected: false,
+		},
+		{
+			Name: "DeadlineExceeded counts as failing",
+			Pods: []v1.Pod{
+				createPod(v1.PodFailed, deployment.DeadlineExceeded),
+				createPod(v1.PodFailed, deployment.Evicted),
+			},
+			Expected:       true,
+			ExpectedReason: deployment.DeadlineExceeded,
+		},
+		{
+			Name: "Failed with unknown reason is ignored",
+			Pods: []v1.Pod{
+				createPod(v1.PodFailed, "Shutdown"),
+			},
+			Expected: false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.DefaultConfig()
+			judge := NewCoreCriteriaJudge(&cfg, nil, newTestMetrics(), nil, nil, true)
+			set := &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "rs"},
+				Spec:       appsv1.ReplicaSetSpec{Replicas: utils.Int32ptr(int32(len(tt.Pods)))},
+			}
+
+			failing, _, verdicts := judge.podsFailingInReplicaset(&Subject{ReplicaSet: set, Pods: tt.Pods}, judge.threshold)
+			if failing != tt.Expected {
+				t.Fatalf("Expected replicaset failing to be %v, got %v (%+v)", tt.Expected, failing, verdicts)
+			}
+			if tt.Expected && verdicts[0].Reason != tt.ExpectedReason {
+				t.Fatalf("Expected reason %s, got %s", tt.ExpectedReason, verdicts[0].Reason)
+			}
+		})
+	}
+}
+
+func TestFailureRatio(t *testing.T) {
+	t.Parallel()
+
+	createPods := func(failing, running int) []v1.Pod {
+		var pods []v1.Pod
+		for i := 0; i < failing; i++ {
+			pods = append(pods, makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{{State: v1.ContainerState{
+					Waiting: &v1.ContainerStateWaiting{Reason: deployment.ImagePullBackOff},
+				}}},
+			}))
+		}
+		for i := 0; i < running; i++ {
+			pods = append(pods, makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{Phase: v1.PodRunning}))
+		}
+
+		return pods
+	}
+	createSidecarFailingPods := func(n int) []v1.Pod {
+		var pods []v1.Pod
+		for i := 0; i < n; i++ {
+			pods = append(pods, makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "app", State: v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"},
+					}},
+					{Name: "linkerd-proxy", State: v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: deployment.ImagePullBackOff},
+					}},
+				},
+			}))
+		}
+
+		return pods
+	}
+
+	cases := []struct {
+		Name          string
+		Pods          []v1.Pod
+		Annotations   map[string]string
+		Expected      bool
+		ExpectedRatio float64
+	}{
+		{
+			Name:          "One healthy pod hides the rest by default",
+			Pods:          createPods(3, 1),
+			Expected:      false,
+			ExpectedRatio: 0.75,
+		},
+		{
+			Name:          "All pods failing",
+			Pods:          createPods(2, 0),
+			Expected:      true,
+			ExpectedRatio: 1,
+		},
+		{
+			Name:          "No pods is not failing",
+			Pods:          nil,
+			Expected:      false,
+			ExpectedRatio: 0,
+		},
+		{
+			Name:          "Ratio lowered by annotation",
+			Pods:          createPods(3, 1),
+			Annotations:   map[string]string{config.FailureRatioAnnotation: "0.5"},
+			Expected:      true,
+			ExpectedRatio: 0.75,
+		},
+		{
+			Name:          "Ratio below annotation",
+			Pods:          createPods(1, 3),
+			Annotations:   map[string]string{config.FailureRatioAnnotation: "0.5"},
+			Expected:      false,
+			ExpectedRatio: 0.25,
+		},
+		{
+			Name: "Too few failing pods",
+			Pods: createPods(1, 0),
+			Annotations: map[string]string{
+				config.FailureRatioAnnotation:   "0.5",
+				config.MinFailingPodsAnnotation: "2",
+			},
+			Expected:      false,
+			ExpectedRatio: 1,
+		},
+		{
+			Name:          "Pods with only a failing sidecar count as healthy",
+			Pods:          append(createPods(1, 0), createSidecarFailingPods(2)...),
+			Expected:      false,
+			ExpectedRatio: 1.0 / 3,
+		},
+		{
+			Name: "Evicted pods are left out of the total",
+			Pods: append(createPods(2, 0), makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+				Phase: v1.PodFailed, Reason: "Evicted",
+			})),
+			Expected:      true,
+			ExpectedRatio: 1,
+		},
+		{
+			Name:          "Invalid annotation falls back to config",
+			Pods:          createPods(3, 1),
+			Annotations:   map[string]string{config.FailureRatioAnnotation: "1.5"},
+			Expected:      false,
+			ExpectedRatio: 0.75,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.DefaultConfig()
+			judge := NewCoreCriteriaJudge(&cfg, nil, newTestMetrics(), nil, nil, true)
+			deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: tt.Annotations}}
+			set := &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "rs"},
+				Spec:       appsv1.ReplicaSetSpec{Replicas: utils.Int32ptr(4)},
+			}
+
+			failing, ratio, verdicts := judge.podsFailingInReplicaset(
+				&Subject{Deployment: deploy, ReplicaSet: set, Pods: tt.Pods}, judge.failureThresholdOf(deploy))
+			if failing != tt.Expected {
+				t.Fatalf("Expected replicaset failing to be %v, got %v (%+v)", tt.Expected, failing, verdicts)
+			}
+			if ratio != tt.ExpectedRatio {
+				t.Fatalf("Expected ratio %v, got %v", tt.ExpectedRatio, ratio)
+			}
+			if len(verdicts) > 0 && verdicts[0].Details["failing_ratio"] == "" {
+				t.Fatalf("Expected ratio in verdict details, got %+v", verdicts[0].Details)
+			}
+		})
+	}
+}
+
+func TestUnschedulablePods(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name             string
+		UnschedulableFor time.Duration
+		Expected         bool
+	}{
+		{
+			Name:             "Unschedulable longer than threshold",
+			UnschedulableFor: 2 * time.Hour,
+			Expected:         true,
+		},
+		{
+			Name:             "Recently unschedulable",
+			UnschedulableFor: 10 * time.Minute,
+			Expected:         false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			message := "0/3 nodes are available: 3 Insufficient cpu."
+			pod := makePodWithState(metav1.ObjectMeta{Name: "pendingpod"}, v1.PodStatus{
+				Phase: v1.PodPending,
+				Conditions: []v1.PodCondition{{
+					Type:               v1.PodScheduled,
+					Status:             v1.ConditionFalse,
+					Reason:             v1.PodReasonUnschedulable,
+					Message:            message,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-tt.UnschedulableFor)),
+				}},
+			})
+
+			cfg := config.DefaultConfig()
+			cfg.UnschedulableAfter = time.Hour
+			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+			verdict := judge.evaluatePod(&Subject{Pod: &pod})
+
+			if (verdict != nil) != tt.Expected {
+				t.Fatalf("Expected pod to be failing: %v, got %+v", tt.Expected, verdict)
+			}
+			if tt.Expected && (verdict.Reason != deployment.Unschedulable || verdict.Message != message) {
+				t.Fatalf("Expected reason %s with scheduler message, got %+v", deployment.Unschedulable, verdict)
+			}
+		})
+	}
+}
+
+func TestNeverReadyPods(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name            string
+		UnreadyFor      time.Duration
+		MinReadySeconds int32
+		ReadinessProbe  *v1.Probe
+		Expected        bool
+	}{
+		{
+			Name:           "Unready longer than max unready",
+			UnreadyFor:     2 * time.Hour,
+			ReadinessProbe: &v1.Probe{},
+			Expected:       true,
+		},
+		{
+			Name:            "Within max unready including minReadySeconds",
+			UnreadyFor:      2 * time.Hour,
+			MinReadySeconds: 7200,
+			ReadinessProbe:  &v1.Probe{},
+			Expected:        false,
+		},
+		{
+			Name:       "Containers without readiness probes are ignored",
+			UnreadyFor: 2 * time.Hour,
+			Expected:   false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			pod := makePodWithState(metav1.ObjectMeta{Name: "unreadypod"}, v1.PodStatus{
+				Phase: v1.PodRunning,
+				Conditions: []v1.PodCondition{{
+					Type:               v1.PodReady,
+					Status:             v1.ConditionFalse,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-tt.UnreadyFor)),
+				}},
+				ContainerStatuses: []v1.ContainerStatus{{Name: "app", Ready: false}},
+			})
+			pod.Spec.Containers = []v1.Container{{Name: "app", ReadinessProbe: tt.ReadinessProbe}}
+			deploy := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{MinReadySeconds: tt.MinReadySeconds}}
+
+			cfg := config.DefaultConfig()
+			cfg.MaxUnready = time.Hour
+			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+			verdict := judge.evaluatePod(&Subject{Deployment: deploy, Pod: &pod})
+
+			if (verdict != nil) != tt.Expected {
+				t.Fatalf("Expected pod to be failing: %v, got %+v", tt.Expected, verdict)
+			}
+			if tt.Expected && verdict.Reason != deployment.NeverReady {
+				t.Fatalf("Expected reason %s, got %s", deployment.NeverReady, verdict.Reason)
+			}
+		})
+	}
+}
+
+func TestProgressDeadlineExceeded(t *testing.T) {
+	t.Parallel()
+
+	createReplicaSet := func(name, revision string) appsv1.ReplicaSet {
+		return appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{deployment.RevisionAnnotationKey: revision},
+		}}
+	}
+
+	cases := []struct {
+		Name     string
+		Message  string
+		Status   v1.ConditionStatus
+		Expected bool
+	}{
+		{
+			Name:     "New replicaset timed out progressing",
+			Message:  `ReplicaSet "app-2" has timed out progressing.`,
+			Status:   v1.ConditionFalse,
+			Expected: true,
+		},
+		{
+			Name:     "Condition concerns an old replicaset",
+			Message:  `ReplicaSet "app-1" has timed out progressing.`,
+			Status:   v1.ConditionFalse,
+			Expected: false,
+		},
+		{
+			Name:     "Deployment is progressing",
+			Message:  `ReplicaSet "app-2" is progressing.`,
+			Status:   v1.ConditionTrue,
+			Expected: false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			deploy := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Annotations: map[string]string{deployment.RevisionAnnotationKey: "2"},
+				},
+				Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{{
+					Type:    appsv1.DeploymentProgressing,
+					Status:  tt.Status,
+					Reason:  deployment.ProgressDeadlineExceeded,
+					Message: tt.Message,
+				}}},
+			}
+			replicaSets := []appsv1.ReplicaSet{createReplicaSet("app-1", "1"), createReplicaSet("app-2", "2")}
+
+			cfg := config.DefaultConfig()
+			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+			verdicts := judge.rules.evaluate(DeploymentScope, &Subject{Deployment: deploy, ReplicaSets: replicaSets})
+
+			if (len(verdicts) > 0) != tt.Expected {
+				t.Fatalf("Expected deployment to be failing: %v, got %+v", tt.Expected, verdicts)
+			}
+			if tt.Expected && (verdicts[0].Message != tt.Message || verdicts[0].Details["replicaset"] != "app-2") {
+				t.Fatalf("Expected condition message and new replicaset in verdict, got %+v", verdicts[0])
+			}
+		})
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name           string
+		Status         v1.ContainerStatus
+		ExpectedReason string
+	}{
+		{
+			Name: "CreateContainerError",
+			Status: v1.ContainerStatus{State: v1.ContainerState{
+				Waiting: &v1.ContainerStateWaiting{Reason: deployment.CreateContainerError},
+			}},
+			ExpectedReason: deployment.CreateContainerError,
+		},
+		{
+			Name: "InvalidImageName",
+			Status: v1.ContainerStatus{State: v1.ContainerState{
+				Waiting: &v1.ContainerStateWaiting{Reason: deployment.InvalidImageName},
+			}},
+			ExpectedReason: deployment.InvalidImageName,
+		},
+		{
+			Name: "RunContainerError",
+			Status: v1.ContainerStatus{State: v1.ContainerState{
+				Waiting: &v1.ContainerStateWaiting{Reason: deployment.RunContainerError},
+			}},
+			ExpectedReason: deployment.RunContainerError,
+		},
+		{
+			Name: "ContainerCannotRun while backing off",
+			Status: v1.ContainerStatus{
+				State: v1.ContainerState{
+					Waiting: &v1.ContainerStateWaiting{Reason: deployment.CrashLoopBackOff},
+				},
+				LastTerminationState: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{Reason: deployment.ContainerCannotRun},
+				},
+			},
+			ExpectedReason: deployment.ContainerCannotRun,
+		},
+		{
+			Name: "ContainerCannotRun once, but running now",
+			Status: v1.ContainerStatus{
+				State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{Reason: deployment.ContainerCannotRun},
+				},
+			},
+			ExpectedReason: "",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.DefaultConfig()
+			judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+			set := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "rs"}}
+
+			pod := makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+				Phase:             v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{tt.Status},
+			})
+			reason := ""
+			if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+				reason = verdict.Reason
+			}
+			if reason != tt.ExpectedReason {
+				t.Fatalf("Expected container reason %q, got %q", tt.ExpectedReason, reason)
+			}
+
+			initPod := makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+				Phase:                 v1.PodPending,
+				InitContainerStatuses: []v1.ContainerStatus{tt.Status},
+			})
+			reason = ""
+			verdicts := judge.rules.evaluate(ReplicaSetScope, &Subject{ReplicaSet: set, Pods: []v1.Pod{initPod}})
+			if len(verdicts) > 0 {
+				reason = verdicts[0].Reason
+			}
+			if reason != tt.ExpectedReason {
+				t.Fatalf("Expected init container reason %q, got %q", tt.ExpectedReason, reason)
+			}
+		})
+	}
+}
+
+func TestStatefulSetFailing(t *testing.T) {
+	t.Parallel()
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "db",
+			Namespace:         "default",
+			UID:               "sts-uid",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+	}
+	owner := []metav1.OwnerReference{*metav1.NewControllerRef(sts, appsv1.SchemeGroupVersion.WithKind("StatefulSet"))}
+	revision := &appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{
+		Name:            "db-abc",
+		Namespace:       "default",
+		Labels:          map[string]string{"app": "db"},
+		OwnerReferences: owner,
+	}, Revision: 1}
+	createPod := func(name string, owner []metav1.OwnerReference) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{"app": "db", appsv1.ControllerRevisionHashLabelKey: "db-abc"},
+				OwnerReferences: owner,
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{{State: v1.ContainerState{
+					Waiting: &v1.ContainerStateWaiting{Reason: deployment.ImagePullBackOff},
+				}}},
+			},
+		}
+	}
+	healthyPod := createPod("other-db-0", nil)
+	healthyPod.Status = v1.PodStatus{Phase: v1.PodRunning}
+
+	c := newFakeClientBuilder().WithObjects(sts, revision, createPod("db-0", owner), healthyPod).Build()
+	cfg := config.DefaultConfig()
+	judge := NewCoreCriteriaJudge(&cfg, c, newTestMetrics(), nil, nil, true)
+
+	failing, verdicts := judge.isStatefulSetFailing(context.Background(), sts)
+	if !failing || verdicts[0].Reason != deployment.ImagePullBackOff {
+		t.Fatalf("Expected statefulset to be failing due to %s, got %v (%+v)",
+			deployment.ImagePullBackOff, failing, verdicts)
+	}
+}
+
+func TestCronJobFailing(t *testing.T) {
+	t.Parallel()
+
+	createJob := func(name string, cronJob *batchv1.CronJob, age time.Duration,
+		condition batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name),
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(cronJob, batchv1.SchemeGroupVersion.WithKind("CronJob")),
+				},
+			},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+				Type: condition, Status: v1.ConditionTrue, Reason: "BackoffLimitExceeded",
+			}}},
+		}
+	}
+
+	createPod := func(job *batchv1.Job) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            job.Name + "-pod",
+				Namespace:       "default",
+				Labels:          map[string]string{"controller-uid": string(job.UID)},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job"))},
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name:  "app",
+					State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: deployment.ImagePullBackOff}},
+				}},
+			},
+		}
+	}
+
+	cases := []struct {
+		Name       string
+		Conditions []batchv1.JobConditionType
+		// FailingPod is the index of the job with a pod failing to pull its image, or -1 for none
+		FailingPod int
+		// HistoryLimit is the failedJobsHistoryLimit of the cronjob, left unset when nil
+		HistoryLimit *int32
+		Expected     bool
+	}{
+		{
+			Name:         "Consecutive failed jobs",
+			Conditions:   []batchv1.JobConditionType{batchv1.JobFailed, batchv1.JobFailed, batchv1.JobFailed},
+			FailingPod:   -1,
+			HistoryLimit: utils.Int32ptr(3),
+			Expected:     true,
+		},
+		{
+			Name:         "Most recent job completed",
+			Conditions:   []batchv1.JobConditionType{batchv1.JobComplete, batchv1.JobFailed, batchv1.JobFailed},
+			FailingPod:   -1,
+			HistoryLimit: utils.Int32ptr(3),
+			Expected:     false,
+		},
+		{
+			Name:         "Not enough failed jobs",
+			Conditions:   []batchv1.JobConditionType{batchv1.JobFailed, batchv1.JobFailed, batchv1.JobComplete},
+			FailingPod:   -1,
+			HistoryLimit: utils.Int32ptr(3),
+			Expected:     false,
+		},
+		{
+			Name:       "Failed job kept by the default history limit",
+			Conditions: []batchv1.JobConditionType{batchv1.JobFailed, batchv1.JobComplete},
+			FailingPod: -1,
+			Expected:   true,
+		},
+		{
+			Name:         "No failed jobs kept",
+			Conditions:   []batchv1.JobConditionType{batchv1.JobComplete},
+			FailingPod:   -1,
+			HistoryLimit: utils.Int32ptr(0),
+			Expected:     false,
+		},
+		{
+			Name:         "Most recent job failing to pull its image",
+			Conditions:   []batchv1.JobConditionType{batchv1.JobComplete, batchv1.JobComplete},
+			FailingPod:   0,
+			HistoryLimit: utils.Int32ptr(3),
+			Expected:     true,
+		},
+		{
+			Name:         "Older job failed to pull its image",
+			Conditions:   []batchv1.JobConditionType{batchv1.JobComplete, batchv1.JobComplete},
+			FailingPod:   1,
+			HistoryLimit: utils.Int32ptr(3),
+			Expected:     false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			cronJob := &batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "cron",
+					Namespace:         "default",
+					UID:               "cron-uid",
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+				},
+				Spec: batchv1.CronJobSpec{FailedJobsHistoryLimit: tt.HistoryLimit},
+			}
+			objects := []client.Object{cronJob}
+			for i, condition := range tt.Conditions {
+				job := createJob(fmt.Sprintf("cron-%d", i), cronJob, time.Duration(i)*time.Minute, condition)
+				objects = append(objects, job)
+				if i == tt.FailingPod {
+					objects = append(objects, createPod(job))
+				}
+			}
+
+			c := newFakeClientBuilder().WithObjects(objects...).Build()
+			cfg := config.DefaultConfig()
+			cfg.FailedJobsThreshold = 3
+			judge := NewCoreCriteriaJudge(&cfg, c, newTestMetrics(), nil, nil, true)
+
+			failing, verdicts := judge.isCronJobFailing(context.Background(), cronJob)
+			if failing != tt.Expected {
+				t.Fatalf("Expected cronjob failing to be %v, got %v (%+v)", tt.Expected, failing, verdicts)
+			}
+			if tt.Expected && tt.FailingPod < 0 && verdicts[0].Reason != deployment.JobFailed {
+				t.Fatalf("Expected reason %s, got %s", deployment.JobFailed, verdicts[0].Reason)
+			}
+		})
+	}
+}
+
+func TestCoreCriteriaJudge_recordHealthyRevision(t *testing.T) {
+	tests := []struct {
+		name       string
+		age        time.Duration
+		available  int32
+		mutate     func(deploy *appsv1.Deployment)
+		annotation bool
+	}{
+		{name: "Rolled out and old enough", age: 2 * time.Hour, available: 2, annotation: true},
+		{name: "Not rolled out", age: 2 * time.Hour, available: 1, annotation: false},
+		{name: "Too young", age: time.Minute, available: 2, annotation: false},
+		{
+			name: "Downscaled",
+			age:  2 * time.Hour,
+			mutate: func(deploy *appsv1.Deployment) {
+				deploy.Spec.Replicas = utils.Int32ptr(0)
+				deploy.Status = appsv1.DeploymentStatus{}
+			},
+			annotation: false,
+		},
+		{
+			name:       "Paused",
+			age:        2 * time.Hour,
+			available:  2,
+			mutate:     func(deploy *appsv1.Deployment) { deploy.Spec.Paused = true },
+			annotation: false,
+		},
+		{
+			// the change-cause is kept by later changes without one, e.g. kubectl apply
+			name:      "Rolled out since a rollback by babylon",
+			age:       2 * time.Hour,
+			available: 2,
+			mutate: func(deploy *appsv1.Deployment) {
+				deploy.Annotations[deployment.ChangeCauseAnnotationKey] = deployment.RollbackCauseAnnotation
+			},
+			annotation: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			deploy := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Namespace:   "default",
+					UID:         "app-uid",
+					Annotations: map[string]string{deployment.RevisionAnnotationKey: "3"},
+				},
+				Spec: appsv1.DeploymentSpec{Replicas: utils.Int32ptr(2)},
+				Status: appsv1.DeploymentStatus{
+					Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: tt.available,
+				},
+			}
+			if tt.mutate != nil {
+				tt.mutate(deploy)
+			}
+			rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+				Name:              "app-abc",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-tt.age)),
+				Labels:            map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "abc"},
+				Annotations:       map[string]string{deployment.RevisionAnnotationKey: "3"},
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(deploy, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+				},
+			}}
+			c := newFakeClientBuilder().WithObjects(deploy, rs).Build()
+
+			cfg := config.DefaultConfig()
+			cfg.ResourceAge = time.Hour
+			judge := NewCoreCriteriaJudge(&cfg, c, newTestMetrics(), nil, nil, true)
+			judge.recordHealthyRevision(context.Background(), deploy)
+
+			actual := &appsv1.Deployment{}
+			_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actual)
+			_, ok := actual.Annotations[config.LastHealthyHashAnnotation]
+			if ok != tt.annotation {
+				t.Fatalf("Expected last healthy annotation to be %t, got %v", tt.annotation, actual.Annotations)
+			}
+			if ok && (actual.Annotations[config.LastHealthyHashAnnotation] != "abc" ||
+				actual.Annotations[config.LastHealthyRevisionAnnotation] != "3") {
+				t.Fatalf("Expected revision 3 (abc) to be recorded, got %v", actual.Annotations)
+			}
+
+			actualRS := &appsv1.ReplicaSet{}
+			_ = c.Get(context.Background(), client.ObjectKeyFromObject(rs), actualRS)
+			if _, ok := actualRS.Annotations[config.HealthyAnnotation]; ok != tt.annotation {
+				t.Fatalf("Expected replicaset to be marked healthy: %t, got %v", tt.annotation, actualRS.Annotations)
+			}
+		})
+	}
+}
+
+func TestFailingPodRatioMetric(t *testing.T) {
+	t.Parallel()
+
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name: "app", Namespace: "default", Annotations: map[string]string{deployment.RevisionAnnotationKey: "2"},
+	}}
+	createReplicaSet := func(revision string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "app-" + revision, Annotations: map[string]string{deployment.RevisionAnnotationKey: revision},
+			},
+			Spec: appsv1.ReplicaSetSpec{Replicas: utils.Int32ptr(1)},
+		}
+	}
+	pods := []v1.Pod{makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{Phase: v1.PodRunning})}
+
+	cfg := config.DefaultConfig()
+	m := newTestMetrics()
+	judge := NewCoreCriteriaJudge(&cfg, nil, m, nil, nil, true)
+	for _, revision := range []string{"1", "2"} {
+		judge.judgePods(deploy, &Subject{Deployment: deploy, ReplicaSet: createReplicaSet(revision), Pods: pods})
+	}
+
+	if count := testutil.CollectAndCount(m.FailingPodRatio); count != 1 {
+		t.Fatalf("Expected a single failing pod ratio series for the deployment, got %d", count)
+	}
+}
+
+func TestCoreCriteriaJudge_OnChange(t *testing.T) {
+	t.Parallel()
+
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	set := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "rs"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: utils.Int32ptr(1)},
+	}
+	pods := []v1.Pod{makePodWithState(metav1.ObjectMeta{Name: "pod"}, v1.PodStatus{
+		Phase: v1.PodPending,
+		ContainerStatuses: []v1.ContainerStatus{{State: v1.ContainerState{
+			Waiting: &v1.ContainerStateWaiting{Reason: deployment.ImagePullBackOff},
+		}}},
+	})}
+
+	cfg := config.DefaultConfig()
+	m := newTestMetrics()
+	judge := NewCoreCriteriaJudge(&cfg, nil, m, nil, nil, true)
+
+	onChange := judge.OnChange()
+	for i := 0; i < 3; i++ {
+		if failing, _ := onChange.judgePods(deploy, &Subject{Deployment: deploy, ReplicaSet: set, Pods: pods}); !failing {
+			t.Fatal("Expected deployment to be failing when judged on change")
+		}
+	}
+	if count := testutil.CollectAndCount(m.RuleActivations); count != 0 {
+		t.Fatalf("Expected no rule activations when judged on change, got %d", count)
+	}
+
+	judge.judgePods(deploy, &Subject{Deployment: deploy, ReplicaSet: set, Pods: pods})
+	if activations := testutil.ToFloat64(m.RuleActivations); activations != 1 {
+		t.Fatalf("Expected a single rule activation when judged periodically, got %v", activations)
+	}
+}
@@ -2,18 +2,30 @@ package criteria
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/nais/babylon/pkg/application"
+	"github.com/nais/babylon/pkg/autoscaler"
 	"github.com/nais/babylon/pkg/config"
 	"github.com/nais/babylon/pkg/deployment"
 	"github.com/nais/babylon/pkg/metrics"
+	"github.com/nais/babylon/pkg/policy"
+	"github.com/nais/babylon/pkg/statefulset"
 	"github.com/nais/babylon/pkg/utils"
+	nais_io_v1alpha1 "github.com/nais/liberator/pkg/apis/nais.io/v1alpha1"
 	"github.com/prometheus/alertmanager/timeinterval"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/strings/slices"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -24,11 +36,17 @@ type Executioner struct {
 	metrics             *metrics.Metrics
 	armed               bool
 	activeTimeIntervals map[string][]timeinterval.TimeInterval
+	policies            *policy.Store
+	actionTimeout       time.Duration
+	// killing is held while cleaning up deployments, as both the reconciler and the gardener do
+	killing sync.Mutex
 }
 
 const (
 	DownscaleStrategy    = "downscale"
 	RolloutAbortStrategy = "abort-rollout"
+	PauseStrategy        = "pause-rollout"
+	SuspendStrategy      = "suspend"
 )
 
 var ErrNoAvailableStrategies = errors.New("no cleanup strategies suitable for this deployment")
@@ -44,38 +62,191 @@ func NewExecutioner(
 		armed:               config.Armed,
 		activeTimeIntervals: config.ActiveTimeIntervals,
 		metrics:             metrics,
+		actionTimeout:       config.ShutdownTimeout,
 	}
 }
 
+// WithPolicies makes the executioner apply the BabylonPolicies in the store to the workloads it governs.
+func (e *Executioner) WithPolicies(policies *policy.Store) *Executioner {
+	e.policies = policies
+
+	return e
+}
+
 func (e *Executioner) Kill(ctx context.Context, deployments []*appsv1.Deployment) {
-	if !e.inActivePeriod(time.Now()) {
-		log.Debug("sleeping due to inactive period")
+	if !e.armed {
+		return
+	}
+
+	e.killing.Lock()
+	defer e.killing.Unlock()
+
+	for _, deploy := range deployments {
+		if ctx.Err() != nil {
+			log.Warnf("Not cleaning up remaining deployments: %v", ctx.Err())
+
+			return
+		}
+		if !e.inActivePeriodFor(deploy, time.Now()) {
+			log.Debugf("sleeping due to inactive period for %s", deploy.Name)
+
+			continue
+		}
+		rolledBack, err := e.isRolledBack(ctx, deploy)
+		if err != nil {
+			log.Errorf("Failed to prune deployment %s: %v", deploy.Name, err)
 
+			continue
+		}
+		if rolledBack {
+			log.Infof("Deployment %s already rolled back, ignoring", deploy.Name)
+
+			continue
+		}
+		if deploy.Spec.Paused {
+			log.Infof("Deployment %s is paused, ignoring", deploy.Name)
+
+			continue
+		}
+		if !deployment.IsDisabled(deploy) {
+			e.inFlight(func(ctx context.Context) {
+				method, err := e.pruneFailingDeployment(ctx, deploy)
+				switch {
+				case errors.Is(err, deployment.ErrAlreadyRolledBack):
+					log.Infof("Not pruning deployment %s: %v", deploy.Name, err)
+				case err != nil:
+					log.Errorf("Failed to prune deployment %s: %v", deploy.Name, err)
+				default:
+					e.history.HistorizeDeploymentKilled(
+						method, deployment.SafeGetLabel(deploy, "team"),
+						e.metrics.SlackChannel(ctx, deploy.Namespace), deploy.Name, e.armed)
+				}
+			})
+		}
+	}
+}
+
+func (e *Executioner) KillStatefulSets(ctx context.Context, statefulSets []*appsv1.StatefulSet) {
+	if !e.armed {
 		return
 	}
 
+	for _, sts := range statefulSets {
+		if ctx.Err() != nil {
+			log.Warnf("Not cleaning up remaining statefulsets: %v", ctx.Err())
+
+			return
+		}
+		if !e.inActivePeriodFor(sts, time.Now()) {
+			log.Debugf("sleeping due to inactive period for %s", sts.Name)
+
+			continue
+		}
+		if sts.Annotations[deployment.ChangeCauseAnnotationKey] == deployment.RollbackCauseAnnotation {
+			log.Infof("StatefulSet %s already rolled back, ignoring", sts.Name)
+
+			continue
+		}
+		if !deployment.IsDisabled(sts) {
+			e.inFlight(func(ctx context.Context) {
+				method, err := e.pruneFailingStatefulSet(ctx, sts)
+				if err != nil {
+					log.Errorf("Failed to prune statefulset %s: %v", sts.Name, err)
+				} else {
+					e.history.HistorizeDeploymentKilled(
+						method, deployment.SafeGetLabel(sts, "team"),
+						e.metrics.SlackChannel(ctx, sts.Namespace), sts.Name, e.armed)
+				}
+			})
+		}
+	}
+}
+
+func (e *Executioner) KillCronJobs(ctx context.Context, cronJobs []*batchv1.CronJob) {
 	if !e.armed {
 		return
 	}
 
-	for _, deploy := range deployments {
-		// TODO: Move to rollbackDeployment?
-		if deploy.Annotations[deployment.ChangeCauseAnnotationKey] == deployment.RollbackCauseAnnotation {
-			log.Infof("Deployment %s already rolled back, ignoring", deploy.Name)
+	for _, cronJob := range cronJobs {
+		if ctx.Err() != nil {
+			log.Warnf("Not cleaning up remaining cronjobs: %v", ctx.Err())
+
+			return
+		}
+		if !e.inActivePeriodFor(cronJob, time.Now()) {
+			log.Debugf("sleeping due to inactive period for %s", cronJob.Name)
 
 			continue
 		}
-		if !deployment.IsDeploymentDisabled(deploy) {
-			method, err := e.pruneFailingDeployment(ctx, deploy)
+
+		if deployment.IsDisabled(cronJob) {
+			continue
+		}
+
+		if strategies, ok := e.configuredStrategies(cronJob); ok && !slices.Contains(strategies, SuspendStrategy) {
+			log.Errorf("Failed to prune cronjob %s: %v", cronJob.Name, ErrNoAvailableStrategies)
+
+			continue
+		}
+
+		e.inFlight(func(ctx context.Context) {
+			err := e.suspendCronJob(ctx, cronJob)
 			if err != nil {
-				log.Errorf("Failed to prune deployment %s: %v", deploy.Name, err)
-			} else {
-				e.history.HistorizeDeploymentKilled(
-					method, deployment.SafeGetLabel(deploy, "team"),
-					e.metrics.SlackChannel(ctx, deploy.Namespace), deploy.Name, e.armed)
+				log.Errorf("Failed to prune cronjob %s: %v", cronJob.Name, err)
+
+				return
+			}
+			e.metrics.IncDeploymentCleanup(cronJob, e.armed, e.metrics.SlackChannel(ctx, cronJob.Namespace),
+				metrics.SuspendLabel)
+			e.history.HistorizeDeploymentKilled(
+				SuspendStrategy, deployment.SafeGetLabel(cronJob, "team"),
+				e.metrics.SlackChannel(ctx, cronJob.Namespace), cronJob.Name, e.armed)
+		})
+	}
+}
+
+// isRolledBack returns whether the deployment has been rolled back by babylon. Deployments owned by an application
+// are rolled back through the application, as naiserator overwrites the annotations of the deployment when syncing.
+func (e *Executioner) isRolledBack(ctx context.Context, deploy *appsv1.Deployment) (bool, error) {
+	app, err := application.GetOwner(ctx, e.client, deploy)
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	if app != nil {
+		return app.Annotations[deployment.ChangeCauseAnnotationKey] == deployment.RollbackCauseAnnotation, nil
+	}
+
+	return deploy.Annotations[deployment.ChangeCauseAnnotationKey] == deployment.RollbackCauseAnnotation, nil
+}
+
+// inFlight runs a single cleanup action with a context that is not cancelled along with the tick, so that e.g. a
+// rollback is not interrupted between patching the deployment and annotating it. The action is bounded by the
+// shutdown timeout instead.
+func (e *Executioner) inFlight(action func(ctx context.Context)) {
+	ctx := context.Background()
+	if e.actionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.actionTimeout)
+		defer cancel()
+	}
+
+	action(ctx)
+}
+
+// inActivePeriodFor returns whether the time is within the active time intervals of the policy governing the
+// workload, or the working hours if there is none.
+func (e *Executioner) inActivePeriodFor(workload client.Object, t time.Time) bool {
+	if policy := e.policies.For(workload); policy != nil && len(policy.ActiveTimeIntervals) > 0 {
+		for _, i := range policy.ActiveTimeIntervals {
+			if i.ContainsTime(t) {
+				return true
 			}
 		}
+
+		return false
 	}
+
+	return e.inActivePeriod(t)
 }
 
 func (e *Executioner) inActivePeriod(time time.Time) bool {
@@ -91,14 +262,23 @@ func (e *Executioner) inActivePeriod(time time.Time) bool {
 }
 
 func (e *Executioner) pruneFailingDeployment(ctx context.Context, deploy *appsv1.Deployment) (string, error) {
-	strategies := getAvailableStrategies(deploy)
+	strategies := e.getAvailableStrategies(deploy)
 
 	if len(strategies) == 0 {
 		return "", ErrNoAvailableStrategies
 	}
 
 	candidate, err := e.getRollbackCandidate(ctx, deploy)
+	noCandidate := errors.Is(err, deployment.ErrNoRollbackCandidateFound)
 	switch {
+	case slices.Contains(strategies, PauseStrategy) && (err == nil || noCandidate):
+		err = e.pauseDeployment(ctx, deploy, candidate)
+		if err != nil {
+			return "", err
+		}
+		e.metrics.IncDeploymentCleanup(deploy, e.armed, e.metrics.SlackChannel(ctx, deploy.Namespace), metrics.PauseLabel)
+
+		return PauseStrategy, nil
 	case slices.Contains(strategies, RolloutAbortStrategy) && err == nil:
 		err = e.rollbackDeployment(ctx, deploy, candidate)
 		if err != nil {
@@ -115,7 +295,7 @@ func (e *Executioner) pruneFailingDeployment(ctx context.Context, deploy *appsv1
 		e.metrics.IncDeploymentCleanup(deploy, e.armed, e.metrics.SlackChannel(ctx, deploy.Namespace), metrics.DownscaleLabel)
 
 		return DownscaleStrategy, nil
-	case err != nil && !errors.Is(err, deployment.ErrNoRollbackCandidateFound):
+	case err != nil && !noCandidate:
 		return "", err
 	default:
 		log.Infof("Attempted to kill deployment %s, but no strategies available", deploy.Name)
@@ -124,16 +304,206 @@ func (e *Executioner) pruneFailingDeployment(ctx context.Context, deploy *appsv1
 	}
 }
 
+func (e *Executioner) pruneFailingStatefulSet(ctx context.Context, sts *appsv1.StatefulSet) (string, error) {
+	strategies := e.getAvailableStrategies(sts)
+
+	if len(strategies) == 0 {
+		return "", ErrNoAvailableStrategies
+	}
+
+	revisions, err := statefulset.GetControllerRevisionsByStatefulSet(ctx, e.client, sts)
+	if err != nil {
+		return "", fmt.Errorf("no controller revisions found: %w", err)
+	}
+	candidate := statefulset.GetRollbackRevision(sts, revisions)
+
+	if slices.Contains(strategies, RolloutAbortStrategy) && candidate != nil {
+		err = e.rollbackStatefulSet(ctx, sts, candidate)
+		switch {
+		case err == nil:
+			e.metrics.IncDeploymentCleanup(sts, e.armed, e.metrics.SlackChannel(ctx, sts.Namespace),
+				metrics.RollbackLabel)
+
+			return RolloutAbortStrategy, nil
+		case !errors.Is(err, statefulset.ErrDeleteStuckPodsFailed) || !slices.Contains(strategies, DownscaleStrategy):
+			return "", err
+		}
+		// the rollback is not rolled out while the stuck pods remain, so the statefulset is downscaled instead
+		log.Warnf("Rollback of statefulset %s incomplete, downscaling instead: %v", sts.Name, err)
+	}
+
+	if slices.Contains(strategies, DownscaleStrategy) {
+		err = e.downscaleStatefulSet(ctx, sts)
+		if err != nil {
+			return "", err
+		}
+		e.metrics.IncDeploymentCleanup(sts, e.armed, e.metrics.SlackChannel(ctx, sts.Namespace), metrics.DownscaleLabel)
+
+		return DownscaleStrategy, nil
+	}
+	log.Infof("Attempted to kill statefulset %s, but no strategies available", sts.Name)
+
+	return "", ErrNoAvailableStrategies
+}
+
+func (e *Executioner) downscaleStatefulSet(ctx context.Context, sts *appsv1.StatefulSet) error {
+	patch := client.MergeFrom(sts.DeepCopy())
+	sts.Spec.Replicas = utils.Int32ptr(0)
+	setChangeCause(sts, deployment.DownscaleCauseAnnotation)
+	err := e.client.Patch(ctx, sts, patch)
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	log.Infof("Downscaled statefulset %s", sts.Name)
+
+	return nil
+}
+
+func (e *Executioner) rollbackStatefulSet(
+	ctx context.Context,
+	sts *appsv1.StatefulSet,
+	revision *appsv1.ControllerRevision) error {
+	template, err := statefulset.GetRevisionTemplate(revision)
+	if err != nil {
+		return fmt.Errorf("failed to roll back statefulset %s: %w", sts.Name, err)
+	}
+	// found before patching, as the update revision changes once the statefulset controller sees the rollback
+	updateRevision := sts.Status.UpdateRevision
+	stuck, err := statefulset.GetStuckPods(ctx, e.client, sts)
+	if err != nil {
+		return fmt.Errorf("%w: %v", statefulset.ErrDeleteStuckPodsFailed, err)
+	}
+
+	patch := client.MergeFrom(sts.DeepCopy())
+	setChangeCause(sts, deployment.RollbackCauseAnnotation)
+	sts.Spec.Template = *template
+	err = e.client.Patch(ctx, sts, patch)
+	if err != nil {
+		log.Errorf("Failed to patch statefulset: %+v", err)
+
+		return deployment.ErrPatchFailed
+	}
+	log.Infof("Rolled back statefulset %s to revision: %s (%d)", sts.Name, revision.Name, revision.Revision)
+
+	for i := range stuck {
+		err = e.client.Delete(ctx, &stuck[i])
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("%w: pod %s: %v", statefulset.ErrDeleteStuckPodsFailed, stuck[i].Name, err)
+		}
+		log.Infof("Deleted pod %s stuck on revision %s of statefulset %s", stuck[i].Name, updateRevision, sts.Name)
+	}
+
+	return nil
+}
+
+func (e *Executioner) suspendCronJob(ctx context.Context, cronJob *batchv1.CronJob) error {
+	patch := client.MergeFrom(cronJob.DeepCopy())
+	suspend := true
+	cronJob.Spec.Suspend = &suspend
+	setChangeCause(cronJob, deployment.SuspendCauseAnnotation)
+	err := e.client.Patch(ctx, cronJob, patch)
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	log.Infof("Suspended cronjob %s", cronJob.Name)
+
+	return nil
+}
+
+// mergeFromUnchanged patches the deployment only if it is unchanged since it was fetched. The reconciler and the
+// gardener fetch deployments separately, so the copy cleaned up by one may be stale after the other cleaned it up.
+func mergeFromUnchanged(deploy *appsv1.Deployment) client.Patch {
+	return client.MergeFromWithOptions(deploy.DeepCopy(), client.MergeFromWithOptimisticLock{})
+}
+
+func setChangeCause(workload metav1.Object, cause string) {
+	annotations := workload.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[deployment.ChangeCauseAnnotationKey] = cause
+	workload.SetAnnotations(annotations)
+}
+
 func (e *Executioner) downscaleDeployment(ctx context.Context, deploy *appsv1.Deployment) error {
-	patch := client.MergeFrom(deploy.DeepCopy())
+	app, err := application.GetOwner(ctx, e.client, deploy)
+	if err != nil {
+		return fmt.Errorf("failed to downscale deployment %s: %w", deploy.Name, err)
+	}
+	if app != nil {
+		return e.downscaleApplication(ctx, app, deploy)
+	}
+
+	// an autoscaler would scale the deployment back up, it is removed once backed up on the deployment
+	hpa, err := autoscaler.GetForDeployment(ctx, e.client, deploy)
+	if err != nil {
+		return fmt.Errorf("failed to downscale deployment %s: %w", deploy.Name, err)
+	}
+
+	patch := mergeFromUnchanged(deploy)
 	deploy.Spec.Replicas = utils.Int32ptr(0)
-	deploy.Annotations[deployment.ChangeCauseAnnotationKey] = deployment.DownscaleCauseAnnotation
-	err := e.client.Patch(ctx, deploy, patch)
+	setChangeCause(deploy, deployment.DownscaleCauseAnnotation)
+	if hpa != nil {
+		backup, err := autoscaler.NewBackup(hpa)
+		if err != nil {
+			return fmt.Errorf("failed to downscale deployment %s: %w", deploy.Name, err)
+		}
+		deploy.Annotations[config.AutoscalerBackupAnnotation] = backup
+	}
+	err = e.client.Patch(ctx, deploy, patch)
 	if err != nil {
 		return fmt.Errorf("failed to apply patch: %w", err)
 	}
 	log.Infof("Downscaled deployment %s", deploy.Name)
 
+	if hpa != nil {
+		err = e.client.Delete(ctx, hpa)
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to remove autoscaler %s: %w", hpa.Name, err)
+		}
+		log.Infof("Removed autoscaler %s of deployment %s, it is restored once the deployment is scaled up",
+			hpa.Name, deploy.Name)
+	}
+
+	return nil
+}
+
+// RestoreAutoscalers recreates the autoscalers removed when downscaling deployments, once they have been scaled
+// back up.
+func (e *Executioner) RestoreAutoscalers(ctx context.Context, deployments []appsv1.Deployment) {
+	for i := range deployments {
+		deploy := &deployments[i]
+		backup, ok := deploy.Annotations[config.AutoscalerBackupAnnotation]
+		if !ok || deploy.Spec.Replicas == nil || *deploy.Spec.Replicas == 0 {
+			continue
+		}
+
+		err := e.restoreAutoscaler(ctx, deploy, backup)
+		if err != nil {
+			log.Errorf("Failed to restore autoscaler of deployment %s: %v", deploy.Name, err)
+		}
+	}
+}
+
+func (e *Executioner) restoreAutoscaler(ctx context.Context, deploy *appsv1.Deployment, backup string) error {
+	hpa, err := autoscaler.FromBackup(backup, deploy.Namespace)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	err = e.client.Create(ctx, hpa)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create autoscaler %s: %w", hpa.Name, err)
+	}
+
+	patch := client.MergeFrom(deploy.DeepCopy())
+	delete(deploy.Annotations, config.AutoscalerBackupAnnotation)
+	err = e.client.Patch(ctx, deploy, patch)
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	log.Infof("Restored autoscaler %s of deployment %s", hpa.Name, deploy.Name)
+
 	return nil
 }
 
@@ -141,21 +511,139 @@ func (e *Executioner) rollbackDeployment(
 	ctx context.Context,
 	deploy *appsv1.Deployment,
 	replicaSet *appsv1.ReplicaSet) error {
-	patch := client.MergeFrom(deploy.DeepCopy())
-	deploy.Annotations[deployment.ChangeCauseAnnotationKey] = deployment.RollbackCauseAnnotation
-	deploy.Spec.Template.Spec = replicaSet.Spec.Template.Spec
-	err := e.client.Patch(ctx, deploy, patch)
+	app, err := application.GetOwner(ctx, e.client, deploy)
+	if err != nil {
+		return fmt.Errorf("failed to roll back deployment %s: %w", deploy.Name, err)
+	}
+	if app != nil {
+		return e.rollbackApplication(ctx, app, deploy, replicaSet)
+	}
+
+	patch := mergeFromUnchanged(deploy)
+	if !deployment.RollbackTo(deploy, replicaSet) {
+		return fmt.Errorf("%w: deployment %s, revision %s", deployment.ErrAlreadyRolledBack,
+			deploy.Name, replicaSet.Annotations[deployment.RevisionAnnotationKey])
+	}
+	setChangeCause(deploy, deployment.RollbackCauseAnnotation)
+	err = e.client.Patch(ctx, deploy, patch)
 	if err != nil {
 		log.Errorf("Failed to patch deployment: %+v", err)
 
 		return deployment.ErrPatchFailed
 	}
 	log.Infof("Rolled back deployment %s to revision: %s",
-		deploy.Name, replicaSet.Annotations["deployment.kubernetes.io/revision"])
+		deploy.Name, replicaSet.Annotations[deployment.RevisionAnnotationKey])
 
 	return nil
 }
 
+// pauseDeployment rolls the pod template of the deployment back to the replicaset, if any, and pauses it. Both are
+// done in a single patch, as a paused deployment does not roll out changes to its template: the failing pods are
+// kept for investigation until the deployment is resumed, at which point the rollback is rolled out.
+func (e *Executioner) pauseDeployment(
+	ctx context.Context,
+	deploy *appsv1.Deployment,
+	replicaSet *appsv1.ReplicaSet) error {
+	app, err := application.GetOwner(ctx, e.client, deploy)
+	if err != nil {
+		return fmt.Errorf("failed to pause deployment %s: %w", deploy.Name, err)
+	}
+	if app != nil {
+		// naiserator would resume the deployment
+		return fmt.Errorf("%w: %s is managed by naiserator", ErrNoAvailableStrategies, deploy.Name)
+	}
+
+	patch := mergeFromUnchanged(deploy)
+	if replicaSet != nil {
+		deployment.RollbackTo(deploy, replicaSet)
+	}
+	setChangeCause(deploy, deployment.PauseCauseAnnotation)
+	deploy.Spec.Paused = true
+	err = e.client.Patch(ctx, deploy, patch)
+	if err != nil {
+		log.Errorf("Failed to patch deployment: %+v", err)
+
+		return deployment.ErrPatchFailed
+	}
+	if replicaSet != nil {
+		log.Infof("Paused deployment %s, rolled back to revision: %s",
+			deploy.Name, replicaSet.Annotations[deployment.RevisionAnnotationKey])
+	} else {
+		log.Infof("Paused deployment %s", deploy.Name)
+	}
+
+	return nil
+}
+
+// downscaleApplication scales the application owning the deployment to 0 replicas, as naiserator would revert
+// changes made to the deployment itself.
+func (e *Executioner) downscaleApplication(
+	ctx context.Context,
+	app *nais_io_v1alpha1.Application,
+	deploy *appsv1.Deployment) error {
+	// zero values are omitted when serializing the application, so the patch is written by hand
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{deployment.ChangeCauseAnnotationKey: deployment.DownscaleCauseAnnotation},
+		},
+		"spec": map[string]interface{}{
+			"replicas": map[string]int{"min": 0, "max": 0},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create patch: %w", err)
+	}
+
+	err = e.client.Patch(ctx, app, client.RawPatch(types.MergePatchType, patch))
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	log.Infof("Downscaled application %s", app.Name)
+
+	return e.annotateChangeCause(ctx, deploy, deployment.DownscaleCauseAnnotation)
+}
+
+// rollbackApplication sets the image of the application owning the deployment to the image of the replicaset.
+func (e *Executioner) rollbackApplication(
+	ctx context.Context,
+	app *nais_io_v1alpha1.Application,
+	deploy *appsv1.Deployment,
+	replicaSet *appsv1.ReplicaSet) error {
+	image, err := application.GetImage(app, replicaSet)
+	if err != nil {
+		return fmt.Errorf("failed to roll back application %s: %w", app.Name, err)
+	}
+
+	patch := client.MergeFrom(app.DeepCopy())
+	setChangeCause(app, deployment.RollbackCauseAnnotation)
+	app.Spec.Image = image
+	err = e.client.Patch(ctx, app, patch)
+	if err != nil {
+		log.Errorf("Failed to patch application: %+v", err)
+
+		return deployment.ErrPatchFailed
+	}
+	log.Infof("Rolled back application %s to image %s from revision: %s",
+		app.Name, image, replicaSet.Annotations[deployment.RevisionAnnotationKey])
+
+	return e.annotateChangeCause(ctx, deploy, deployment.RollbackCauseAnnotation)
+}
+
+// annotateChangeCause marks the deployment with the cleanup performed on its owner.
+func (e *Executioner) annotateChangeCause(ctx context.Context, deploy *appsv1.Deployment, cause string) error {
+	patch := client.MergeFrom(deploy.DeepCopy())
+	setChangeCause(deploy, cause)
+	err := e.client.Patch(ctx, deploy, patch)
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	return nil
+}
+
+// getRollbackCandidate returns the replicaset of the revision last judged healthy, or otherwise the newest revision
+// judged healthy before, even if they have been scaled down. Only if no revision has been judged healthy, e.g. as
+// babylon has not been running for long, the newest revision still running is returned.
 func (e *Executioner) getRollbackCandidate(
 	ctx context.Context,
 	deploy *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
@@ -166,32 +654,80 @@ func (e *Executioner) getRollbackCandidate(
 		return nil, fmt.Errorf("no replica set found: %w", err)
 	}
 
-	if len(rs.Items) == 0 {
-		// 0 replicaSets assumed to not be possible
-		log.Fatal("encountered deployment without replicaset")
+	candidates := make([]*appsv1.ReplicaSet, 0, len(rs.Items))
+	for i := range rs.Items {
+		if rs.Items[i].Annotations[deployment.RevisionAnnotationKey] !=
+			deploy.Annotations[deployment.RevisionAnnotationKey] {
+			candidates = append(candidates, &rs.Items[i])
+		}
 	}
 
-	for _, replicaSet := range rs.Items {
-		if replicaSet.Annotations["deployment.kubernetes.io/revision"] ==
-			deploy.Annotations["deployment.kubernetes.io/revision"] {
-			continue
+	// the revision of a replicaset changes when rolled back to, while its pod template hash does not
+	hash, hasHash := deploy.Annotations[config.LastHealthyHashAnnotation]
+	revision, hasRevision := deploy.Annotations[config.LastHealthyRevisionAnnotation]
+	for _, candidate := range candidates {
+		if hasHash && candidate.Labels[appsv1.DefaultDeploymentUniqueLabelKey] == hash ||
+			!hasHash && hasRevision && candidate.Annotations[deployment.RevisionAnnotationKey] == revision {
+			return candidate, nil
 		}
+	}
+	if hasHash || hasRevision {
+		log.Infof("Last healthy revision %s (%s) of deployment %s not found, using newest healthy revision",
+			revision, hash, deploy.Name)
+	}
 
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return deployment.GetRevision(candidates[i]) > deployment.GetRevision(candidates[j])
+	})
+	for _, candidate := range candidates {
+		if _, ok := candidate.Annotations[config.HealthyAnnotation]; ok {
+			return candidate, nil
+		}
+	}
+	for _, candidate := range candidates {
 		// if replicaset has running pods (good state)
-		if *replicaSet.Spec.Replicas > 0 {
-			return &replicaSet, nil
+		if candidate.Spec.Replicas != nil && *candidate.Spec.Replicas > 0 {
+			return candidate, nil
 		}
 	}
 
 	return nil, deployment.ErrNoRollbackCandidateFound
 }
 
-func getAvailableStrategies(deployment *appsv1.Deployment) (strategies []string) {
-	if s, ok := deployment.Annotations[config.StrategyAnnotation]; ok {
-		strategies = strings.Split(s, ",")
-	} else {
-		strategies = []string{RolloutAbortStrategy, DownscaleStrategy}
+func (e *Executioner) getAvailableStrategies(workload client.Object) []string {
+	if strategies, ok := e.configuredStrategies(workload); ok {
+		return strategies
+	}
+
+	return []string{RolloutAbortStrategy, DownscaleStrategy}
+}
+
+// configuredStrategies returns the strategies of the workload's annotation, or of the policy governing it. The
+// annotation can only choose among the strategies allowed by the policy.
+func (e *Executioner) configuredStrategies(workload client.Object) ([]string, bool) {
+	var allowed []string
+	if policy := e.policies.For(workload); policy != nil && policy.Strategies != nil {
+		allowed = policy.Strategies
 	}
 
-	return
+	s, ok := workload.GetAnnotations()[config.StrategyAnnotation]
+	switch {
+	case ok && allowed != nil:
+		var strategies []string
+		for _, strategy := range strings.Split(s, ",") {
+			if slices.Contains(allowed, strategy) {
+				strategies = append(strategies, strategy)
+			} else {
+				log.Infof("Strategy %s of %s is not allowed by its policy, ignoring", strategy, workload.GetName())
+			}
+		}
+
+		return strategies, true
+	case ok:
+		return strings.Split(s, ","), true
+	case allowed != nil:
+		return allowed, true
+	default:
+		return nil, false
+	}
 }
@@ -1,14 +1,74 @@
 package criteria
 
 import (
+	"context"
+	"errors"
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
 	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/deployment"
+	"github.com/nais/babylon/pkg/policy"
+	"github.com/nais/babylon/pkg/utils"
+	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	nais_io_v1alpha1 "github.com/nais/liberator/pkg/apis/nais.io/v1alpha1"
 	promconfig "github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/alertmanager/timeinterval"
 	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/strings/slices"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
 	"testing"
 	"time"
 )
 
+// createTemplate creates a pod template for the given version of the app, labelled with the pod-template-hash
+// the deployment controller adds to the templates of its replicasets, if any.
+func createTemplate(version, hash string) v1.PodTemplateSpec {
+	labels := map[string]string{"app": "app", "version": version}
+	if hash != "" {
+		labels[appsv1.DefaultDeploymentUniqueLabelKey] = hash
+	}
+
+	return v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      labels,
+			Annotations: map[string]string{"prometheus.io/scrape": version},
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:" + version}}},
+	}
+}
+
+// createReplicaSet creates a replicaset of the given revision controlled by the deployment, the way the deployment
+// controller would.
+func createReplicaSet(owner *appsv1.Deployment, revision, hash string, replicas int32) *appsv1.ReplicaSet {
+	template := createTemplate(revision, hash)
+	name := owner.Name + "-" + hash
+
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   owner.Namespace,
+			UID:         types.UID(owner.Namespace + "-" + name),
+			Labels:      template.Labels,
+			Annotations: map[string]string{deployment.RevisionAnnotationKey: revision},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(owner, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{Replicas: utils.Int32ptr(replicas), Template: template},
+	}
+}
+
 func TestConfig_InActivePeriod(t *testing.T) {
 	t.Parallel()
 
@@ -100,3 +160,637 @@ func TestConfig_InActivePeriod(t *testing.T) {
 		})
 	}
 }
+
+func TestExecutioner_pruneFailingStatefulSet(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name             string
+		CurrentRevision  string
+		ExpectedStrategy string
+		ExpectedImage    string
+		ExpectedReplicas int32
+		ExpectedPods     []string
+	}{
+		{
+			Name:             "Rolls back to the revision being rolled out from",
+			CurrentRevision:  "db-1",
+			ExpectedStrategy: RolloutAbortStrategy,
+			ExpectedImage:    "db:1",
+			ExpectedReplicas: 3,
+			// the stuck pod is deleted, so that it is recreated from the restored template
+			ExpectedPods: []string{"db-0", "db-1"},
+		},
+		{
+			Name:             "Downscales when not in the middle of a rollout",
+			CurrentRevision:  "db-2",
+			ExpectedStrategy: DownscaleStrategy,
+			ExpectedImage:    "db:2",
+			ExpectedReplicas: 0,
+			ExpectedPods:     []string{"db-0", "db-1", "db-2"},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", UID: "sts-uid"},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: utils.Int32ptr(3),
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+					Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "db", Image: "db:2"}}}},
+				},
+				Status: appsv1.StatefulSetStatus{CurrentRevision: tt.CurrentRevision, UpdateRevision: "db-2"},
+			}
+			owner := []metav1.OwnerReference{*metav1.NewControllerRef(sts, appsv1.SchemeGroupVersion.WithKind("StatefulSet"))}
+			createRevision := func(name, image string, revision int64) *appsv1.ControllerRevision {
+				return &appsv1.ControllerRevision{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: name, Namespace: "default", Labels: map[string]string{"app": "db"}, OwnerReferences: owner,
+					},
+					Data: runtime.RawExtension{Raw: []byte(`{"spec":{"template":{"$patch":"replace",` +
+						`"spec":{"containers":[{"name":"db","image":"` + image + `"}]}}}}`)},
+					Revision: revision,
+				}
+			}
+
+			createPod := func(name, revision string, ready v1.ConditionStatus) *v1.Pod {
+				return &v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: "default",
+						Labels: map[string]string{
+							"app": "db", appsv1.ControllerRevisionHashLabelKey: revision,
+						},
+						OwnerReferences: owner,
+					},
+					Status: v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: ready}}},
+				}
+			}
+
+			c := newFakeClientBuilder().
+				WithObjects(sts, createRevision("db-1", "db:1", 1), createRevision("db-2", "db:2", 2),
+					createPod("db-0", "db-1", v1.ConditionTrue), createPod("db-1", "db-1", v1.ConditionTrue),
+					createPod("db-2", "db-2", v1.ConditionFalse)).
+				Build()
+			cfg := config.DefaultConfig()
+			executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+			strategy, err := executioner.pruneFailingStatefulSet(context.Background(), sts)
+			if err != nil || strategy != tt.ExpectedStrategy {
+				t.Fatalf("Expected strategy %s, got %s (err: %v)", tt.ExpectedStrategy, strategy, err)
+			}
+
+			actual := &appsv1.StatefulSet{}
+			_ = c.Get(context.Background(), client.ObjectKeyFromObject(sts), actual)
+			if image := actual.Spec.Template.Spec.Containers[0].Image; image != tt.ExpectedImage {
+				t.Fatalf("Expected image %s, got %s", tt.ExpectedImage, image)
+			}
+			if *actual.Spec.Replicas != tt.ExpectedReplicas {
+				t.Fatalf("Expected %d replicas, got %d", tt.ExpectedReplicas, *actual.Spec.Replicas)
+			}
+
+			pods := &v1.PodList{}
+			_ = c.List(context.Background(), pods)
+			var names []string
+			for _, pod := range pods.Items {
+				names = append(names, pod.Name)
+			}
+			if !reflect.DeepEqual(names, tt.ExpectedPods) {
+				t.Fatalf("Expected pods %v, got %v", tt.ExpectedPods, names)
+			}
+		})
+	}
+}
+
+func TestExecutioner_suspendCronJob(t *testing.T) {
+	t.Parallel()
+
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "cron", Namespace: "default"}}
+	c := newFakeClientBuilder().WithObjects(cronJob).Build()
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+	if err := executioner.suspendCronJob(context.Background(), cronJob); err != nil {
+		t.Fatalf("Expected cronjob to be suspended, got error: %v", err)
+	}
+
+	actual := &batchv1.CronJob{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(cronJob), actual)
+	if actual.Spec.Suspend == nil || !*actual.Spec.Suspend {
+		t.Fatalf("Expected cronjob to be suspended, got %+v", actual.Spec)
+	}
+	if actual.Annotations[deployment.ChangeCauseAnnotationKey] != deployment.SuspendCauseAnnotation {
+		t.Fatalf("Expected change cause annotation, got %v", actual.Annotations)
+	}
+}
+
+func TestExecutioner_KillCronJobs_cancelled(t *testing.T) {
+	t.Parallel()
+
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "cron", Namespace: "default"}}
+	c := newFakeClientBuilder().WithObjects(cronJob).Build()
+	cfg := config.DefaultConfig()
+	cfg.Armed = true
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	executioner.KillCronJobs(ctx, []*batchv1.CronJob{cronJob})
+
+	actual := &batchv1.CronJob{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(cronJob), actual)
+	if actual.Spec.Suspend != nil && *actual.Spec.Suspend {
+		t.Fatalf("Expected no cleanup to be started once cancelled, got %+v", actual.Spec)
+	}
+}
+
+func TestExecutioner_ApplicationOwnedDeployment(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = nais_io_v1alpha1.AddToScheme(scheme)
+
+	setup := func() (client.Client, *nais_io_v1alpha1.Application, *appsv1.Deployment) {
+		app := &nais_io_v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "app-uid"},
+			Spec: nais_io_v1alpha1.ApplicationSpec{
+				Image:    "app:2",
+				Replicas: &nais_io_v1.Replicas{Min: 2, Max: 4},
+			},
+		}
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "app",
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(app, nais_io_v1alpha1.GroupVersion.WithKind("Application")),
+				},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: utils.Int32ptr(2),
+				Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:2"}}}},
+			},
+		}
+		c := newFakeClientBuilder().WithScheme(scheme).WithObjects(app, deploy).Build()
+
+		return c, app, deploy
+	}
+
+	t.Run("Rollback sets the image of the application", func(t *testing.T) {
+		t.Parallel()
+
+		c, app, deploy := setup()
+		cfg := config.DefaultConfig()
+		executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+		replicaSet := &appsv1.ReplicaSet{Spec: appsv1.ReplicaSetSpec{Template: v1.PodTemplateSpec{
+			Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:1"}}},
+		}}}
+
+		if err := executioner.rollbackDeployment(context.Background(), deploy, replicaSet); err != nil {
+			t.Fatalf("Expected rollback to succeed, got error: %v", err)
+		}
+
+		actualApp := &nais_io_v1alpha1.Application{}
+		_ = c.Get(context.Background(), client.ObjectKeyFromObject(app), actualApp)
+		if actualApp.Spec.Image != "app:1" {
+			t.Fatalf("Expected application image to be rolled back, got %s", actualApp.Spec.Image)
+		}
+
+		actualDeploy := &appsv1.Deployment{}
+		_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actualDeploy)
+		if actualDeploy.Spec.Template.Spec.Containers[0].Image != "app:2" {
+			t.Fatalf("Expected deployment template to be left to naiserator, got %+v", actualDeploy.Spec.Template)
+		}
+		if actualDeploy.Annotations[deployment.ChangeCauseAnnotationKey] != deployment.RollbackCauseAnnotation {
+			t.Fatalf("Expected deployment to be marked as rolled back, got %v", actualDeploy.Annotations)
+		}
+
+		// naiserator overwrites the annotations of the deployment when syncing the application
+		actualDeploy.Annotations = nil
+		if rolledBack, err := executioner.isRolledBack(context.Background(), actualDeploy); err != nil || !rolledBack {
+			t.Fatalf("Expected application to be recognized as rolled back, got %v (err: %v)", rolledBack, err)
+		}
+	})
+
+	t.Run("Downscale scales the application to zero", func(t *testing.T) {
+		t.Parallel()
+
+		c, app, deploy := setup()
+		cfg := config.DefaultConfig()
+		executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+		if err := executioner.downscaleDeployment(context.Background(), deploy); err != nil {
+			t.Fatalf("Expected downscale to succeed, got error: %v", err)
+		}
+
+		actualApp := &nais_io_v1alpha1.Application{}
+		_ = c.Get(context.Background(), client.ObjectKeyFromObject(app), actualApp)
+		if actualApp.Spec.Replicas.Min != 0 || actualApp.Spec.Replicas.Max != 0 {
+			t.Fatalf("Expected application replicas to be 0, got %+v", actualApp.Spec.Replicas)
+		}
+
+		actualDeploy := &appsv1.Deployment{}
+		_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actualDeploy)
+		if *actualDeploy.Spec.Replicas != 2 {
+			t.Fatalf("Expected deployment replicas to be left to naiserator, got %d", *actualDeploy.Spec.Replicas)
+		}
+	})
+}
+
+func TestExecutioner_getRollbackCandidate_overlappingSelectors(t *testing.T) {
+	t.Parallel()
+
+	labels := map[string]string{"app": "app"}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			UID:         "app-uid",
+			Annotations: map[string]string{deployment.RevisionAnnotationKey: "2"},
+		},
+		Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+	// sorted before the deployment's own replicasets, and matching its selector
+	other := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", UID: "a-uid"}}
+	elsewhere := createReplicaSet(deploy, "3", "h3", 2)
+	elsewhere.Name, elsewhere.Namespace = "a-elsewhere", "other"
+
+	previous := createReplicaSet(deploy, "1", "h1", 1)
+	current := createReplicaSet(deploy, "2", "h2", 2)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "app-h2-pod",
+		Namespace: "default",
+		Labels:    labels,
+		OwnerReferences: []metav1.OwnerReference{
+			*metav1.NewControllerRef(current, appsv1.SchemeGroupVersion.WithKind("ReplicaSet")),
+		},
+	}}
+	otherPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other-pod", Namespace: "other", Labels: labels}}
+
+	c := newFakeClientBuilder().WithObjects(
+		previous,
+		current,
+		createReplicaSet(other, "3", "h3", 2),
+		elsewhere,
+		pod,
+		otherPod,
+	).Build()
+
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+	candidate, err := executioner.getRollbackCandidate(context.Background(), deploy)
+	if err != nil {
+		t.Fatalf("Expected a rollback candidate, got error: %v", err)
+	}
+	if candidate.Name != previous.Name {
+		t.Fatalf("Expected rollback candidate %s, got %s", previous.Name, candidate.Name)
+	}
+
+	pods, err := deployment.GetPodsFromReplicaSet(context.Background(), c, current)
+	if err != nil {
+		t.Fatalf("Expected to get pods, got error: %v", err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != pod.Name {
+		t.Fatalf("Expected only the pods owned by the replicaset, got %+v", pods.Items)
+	}
+}
+
+func TestExecutioner_getRollbackCandidate_lastHealthy(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		healthy     []string
+		expected    string
+	}{
+		{
+			name:        "Last healthy revision even if scaled down",
+			annotations: map[string]string{config.LastHealthyHashAnnotation: "h2"},
+			healthy:     []string{"h1", "h2"},
+			expected:    "app-h2",
+		},
+		{
+			name: "Last healthy hash is preferred over revision, which changes on rollback",
+			annotations: map[string]string{
+				config.LastHealthyHashAnnotation:     "h1",
+				config.LastHealthyRevisionAnnotation: "2",
+			},
+			healthy:  []string{"h1", "h2"},
+			expected: "app-h1",
+		},
+		{
+			name:        "Last healthy revision without hash",
+			annotations: map[string]string{config.LastHealthyRevisionAnnotation: "1"},
+			healthy:     []string{"h1", "h2"},
+			expected:    "app-h1",
+		},
+		{
+			name:        "Never the current revision",
+			annotations: map[string]string{config.LastHealthyHashAnnotation: "h5"},
+			healthy:     []string{"h1", "h2", "h5"},
+			expected:    "app-h2",
+		},
+		{
+			name:        "Newest revision judged healthy when last healthy is gone",
+			annotations: map[string]string{config.LastHealthyHashAnnotation: "h0"},
+			healthy:     []string{"h1", "h2"},
+			expected:    "app-h2",
+		},
+		{
+			name:     "Newest revision judged healthy when none is recorded",
+			healthy:  []string{"h1", "h2"},
+			expected: "app-h2",
+		},
+		{
+			name:     "Newest running revision when none has been judged healthy",
+			expected: "app-h4",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			annotations := map[string]string{deployment.RevisionAnnotationKey: "11"}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+				Name: "app", Namespace: "default", UID: "app-uid", Annotations: annotations,
+			}}
+			builder := newFakeClientBuilder()
+			for _, rs := range []*appsv1.ReplicaSet{
+				createReplicaSet(deploy, "1", "h1", 1),
+				createReplicaSet(deploy, "2", "h2", 0),
+				createReplicaSet(deploy, "9", "h3", 1),
+				createReplicaSet(deploy, "10", "h4", 1),
+				createReplicaSet(deploy, "11", "h5", 2),
+			} {
+				if slices.Contains(tt.healthy, rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]) {
+					rs.Annotations[config.HealthyAnnotation] = time.Now().Format(time.RFC3339)
+				}
+				builder = builder.WithObjects(rs)
+			}
+			c := builder.Build()
+
+			cfg := config.DefaultConfig()
+			executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+			candidate, err := executioner.getRollbackCandidate(context.Background(), deploy)
+			if err != nil {
+				t.Fatalf("Expected a rollback candidate, got error: %v", err)
+			}
+			if candidate.Name != tt.expected {
+				t.Fatalf("Expected rollback candidate %s, got %s", tt.expected, candidate.Name)
+			}
+		})
+	}
+}
+
+func TestExecutioner_pruneFailingDeployment_stale(t *testing.T) {
+	t.Parallel()
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: utils.Int32ptr(2)},
+	}
+	c := newFakeClientBuilder().WithObjects(deploy).Build()
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+	// fetched separately by the reconciler and the gardener
+	fetched, stale := &appsv1.Deployment{}, &appsv1.Deployment{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), fetched)
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), stale)
+
+	if _, err := executioner.pruneFailingDeployment(context.Background(), fetched); err != nil {
+		t.Fatalf("Expected deployment to be cleaned up, got error: %v", err)
+	}
+	if _, err := executioner.pruneFailingDeployment(context.Background(), stale); !k8serrors.IsConflict(err) {
+		t.Fatalf("Expected cleanup of stale deployment to conflict, got error: %v", err)
+	}
+}
+
+func TestExecutioner_downscaleDeployment_autoscaler(t *testing.T) {
+	t.Parallel()
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: utils.Int32ptr(2)},
+	}
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			Labels:    map[string]string{"team": "a"},
+			Annotations: map[string]string{
+				"team":                         "a",
+				v1.LastAppliedConfigAnnotation: "{}",
+				"autoscaling.alpha.kubernetes.io/conditions": "[]",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "nais.io/v1alpha1", Kind: "Application", Name: "app", UID: "app-uid"},
+			},
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app"},
+			MinReplicas:    utils.Int32ptr(2),
+			MaxReplicas:    4,
+		},
+	}
+	c := newFakeClientBuilder().WithObjects(deploy, hpa).Build()
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+	if err := executioner.downscaleDeployment(context.Background(), deploy); err != nil {
+		t.Fatalf("Expected downscale to succeed, got error: %v", err)
+	}
+
+	err := c.Get(context.Background(), client.ObjectKeyFromObject(hpa), &autoscalingv1.HorizontalPodAutoscaler{})
+	if !k8serrors.IsNotFound(err) {
+		t.Fatalf("Expected autoscaler to be removed, got error: %v", err)
+	}
+	actual := &appsv1.Deployment{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actual)
+	if *actual.Spec.Replicas != 0 || actual.Annotations[config.AutoscalerBackupAnnotation] == "" {
+		t.Fatalf("Expected deployment to be downscaled with the autoscaler backed up, got %+v", actual.ObjectMeta)
+	}
+
+	deployments := []appsv1.Deployment{*actual}
+	executioner.RestoreAutoscalers(context.Background(), deployments)
+	if _, ok := deployments[0].Annotations[config.AutoscalerBackupAnnotation]; !ok {
+		t.Fatal("Expected autoscaler not to be restored while the deployment is scaled down")
+	}
+
+	deployments[0].Spec.Replicas = utils.Int32ptr(1)
+	executioner.RestoreAutoscalers(context.Background(), deployments)
+
+	restored := &autoscalingv1.HorizontalPodAutoscaler{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(hpa), restored); err != nil {
+		t.Fatalf("Expected autoscaler to be restored, got error: %v", err)
+	}
+	if *restored.Spec.MinReplicas != 2 || restored.Spec.MaxReplicas != 4 || restored.Labels["team"] != "a" {
+		t.Fatalf("Expected original autoscaler to be restored, got %+v", restored)
+	}
+	if !reflect.DeepEqual(restored.OwnerReferences, hpa.OwnerReferences) {
+		t.Fatalf("Expected owner references %v to be restored, got %v", hpa.OwnerReferences, restored.OwnerReferences)
+	}
+	if !reflect.DeepEqual(restored.Annotations, map[string]string{"team": "a"}) {
+		t.Fatalf("Expected status and last applied annotations not to be restored, got %v", restored.Annotations)
+	}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actual)
+	if _, ok := actual.Annotations[config.AutoscalerBackupAnnotation]; ok {
+		t.Fatalf("Expected backup to be removed once restored, got %v", actual.Annotations)
+	}
+}
+
+func TestExecutioner_pruneFailingDeployment_pause(t *testing.T) {
+	t.Parallel()
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			UID:       "app-uid",
+			Annotations: map[string]string{
+				config.StrategyAnnotation:        PauseStrategy,
+				deployment.RevisionAnnotationKey: "2",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: utils.Int32ptr(1), Template: createTemplate("2", "")},
+	}
+	c := newFakeClientBuilder().
+		WithObjects(deploy, createReplicaSet(deploy, "1", "h1", 1), createReplicaSet(deploy, "2", "h2", 1)).
+		Build()
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+	strategy, err := executioner.pruneFailingDeployment(context.Background(), deploy)
+	if err != nil || strategy != PauseStrategy {
+		t.Fatalf("Expected deployment to be paused, got strategy %s and error: %v", strategy, err)
+	}
+
+	actual := &appsv1.Deployment{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actual)
+	previous := createTemplate("1", "")
+	if !actual.Spec.Paused || !deployment.EqualIgnoreHash(&actual.Spec.Template, &previous) {
+		t.Fatalf("Expected deployment to be paused and rolled back, got %+v", actual.Spec)
+	}
+	if actual.Annotations[deployment.ChangeCauseAnnotationKey] != deployment.PauseCauseAnnotation {
+		t.Fatalf("Expected change cause annotation, got %v", actual.Annotations)
+	}
+}
+
+func TestExecutioner_rollbackDeployment_adoptsReplicaSet(t *testing.T) {
+	t.Parallel()
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			UID:       "app-uid",
+			Annotations: map[string]string{
+				deployment.RevisionAnnotationKey:    "2",
+				deployment.ChangeCauseAnnotationKey: "deploy 2",
+				v1.LastAppliedConfigAnnotation:      "{}",
+				config.FailureDetectedAnnotation:    time.Now().Format(time.RFC3339),
+				"team":                              "b",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: utils.Int32ptr(1), Template: createTemplate("2", "")},
+	}
+	previous, current := createReplicaSet(deploy, "1", "h1", 1), createReplicaSet(deploy, "2", "h2", 1)
+	for _, rs := range []*appsv1.ReplicaSet{previous, current} {
+		rs.Annotations[deployment.ChangeCauseAnnotationKey] = "deploy " + rs.Annotations[deployment.RevisionAnnotationKey]
+		rs.Annotations["team"] = "a"
+	}
+	c := newFakeClientBuilder().WithObjects(deploy, previous, current).Build()
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil)
+
+	err := executioner.rollbackDeployment(context.Background(), deploy, previous)
+	if err != nil {
+		t.Fatalf("Expected deployment to be rolled back, got error: %v", err)
+	}
+
+	actual := &appsv1.Deployment{}
+	_ = c.Get(context.Background(), client.ObjectKeyFromObject(deploy), actual)
+	// the deployment controller hashes the template to find its replicaset, so the template of the previous
+	// replicaset, labels and annotations included, must be restored exactly, without its pod-template-hash label
+	expectedTemplate := createTemplate("1", "")
+	if !equality.Semantic.DeepEqual(actual.Spec.Template, expectedTemplate) {
+		t.Fatalf("Expected template %+v, got %+v", expectedTemplate, actual.Spec.Template)
+	}
+
+	expected := map[string]string{
+		deployment.RevisionAnnotationKey:    "2",
+		deployment.ChangeCauseAnnotationKey: deployment.RollbackCauseAnnotation,
+		v1.LastAppliedConfigAnnotation:      "{}",
+		config.FailureDetectedAnnotation:    deploy.Annotations[config.FailureDetectedAnnotation],
+		"team":                              "a",
+	}
+	for k, v := range expected {
+		if actual.Annotations[k] != v {
+			t.Fatalf("Expected annotation %s to be %q, got %v", k, v, actual.Annotations)
+		}
+	}
+
+	// rolling back to the template the deployment already has changes nothing
+	err = executioner.rollbackDeployment(context.Background(), actual, previous)
+	if !errors.Is(err, deployment.ErrAlreadyRolledBack) {
+		t.Fatalf("Expected rollback to be skipped, got error: %v", err)
+	}
+}
+
+func TestExecutioner_getAvailableStrategies_policy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = babylon_nais_io_v1alpha1.AddToScheme(scheme)
+
+	babylonPolicy := &babylon_nais_io_v1alpha1.BabylonPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-downscale", Namespace: "default"},
+		Spec:       babylon_nais_io_v1alpha1.BabylonPolicySpec{Strategies: []string{RolloutAbortStrategy}},
+	}
+	c := newFakeClientBuilder().WithScheme(scheme).WithObjects(babylonPolicy).Build()
+	policies := policy.NewStore(c)
+	if err := policies.Refresh(context.Background()); err != nil {
+		t.Fatalf("Expected policies to refresh, got error: %v", err)
+	}
+	cfg := config.DefaultConfig()
+	executioner := NewExecutioner(&cfg, c, newTestMetrics(), nil).WithPolicies(policies)
+
+	tests := []struct {
+		name       string
+		annotation string
+		expected   []string
+	}{
+		{name: "Policy without annotation", expected: []string{RolloutAbortStrategy}},
+		{
+			name:       "Annotation limited to the strategies allowed by the policy",
+			annotation: DownscaleStrategy + "," + RolloutAbortStrategy,
+			expected:   []string{RolloutAbortStrategy},
+		},
+		{name: "Annotation with only strategies not allowed", annotation: DownscaleStrategy},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+			if tt.annotation != "" {
+				deploy.Annotations = map[string]string{config.StrategyAnnotation: tt.annotation}
+			}
+
+			actual := executioner.getAvailableStrategies(deploy)
+			if strings.Join(actual, ",") != strings.Join(tt.expected, ",") {
+				t.Fatalf("Expected strategies %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
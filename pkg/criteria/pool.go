@@ -0,0 +1,65 @@
+package criteria
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// pool judges workloads in parallel, with a bounded number of workers and optionally a limited rate, as judging
+// a single workload takes several calls to the API server.
+type pool struct {
+	workers int
+	limiter flowcontrol.RateLimiter
+}
+
+func newPool(workers int, rateLimit float64) *pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &pool{workers: workers}
+	if rateLimit > 0 {
+		p.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(rateLimit), workers)
+	}
+
+	return p
+}
+
+// run calls judge for each of the n workloads, and returns whether each of them should be cleaned up in the order
+// given regardless of the order they were judged in. Workloads not yet judged when the context is done are not.
+func (p *pool) run(ctx context.Context, n int, kind string, judge func(i int) bool) []bool {
+	results := make([]bool, n)
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = judge(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			log.Warnf("Not judging remaining %s: %v", kind, ctx.Err())
+
+			break
+		}
+		if p.limiter != nil && p.limiter.Wait(ctx) != nil {
+			log.Warnf("Not judging remaining %s: %v", kind, ctx.Err())
+
+			break
+		}
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,56 @@
+package criteria
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_run(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name      string
+		Workers   int
+		RateLimit float64
+		Cancelled bool
+		Expected  int32
+	}{
+		{Name: "Single worker", Workers: 1, Expected: 20},
+		{Name: "Parallel workers", Workers: 4, Expected: 20},
+		{Name: "Rate limited", Workers: 4, RateLimit: 1000, Expected: 20},
+		{Name: "Cancelled judges nothing", Workers: 4, Cancelled: true, Expected: 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.Cancelled {
+				cancel()
+			}
+
+			var judged int32
+			results := newPool(tt.Workers, tt.RateLimit).run(ctx, 20, "deployments", func(i int) bool {
+				atomic.AddInt32(&judged, 1)
+				// judged out of order, as later workloads finish sooner
+				time.Sleep(time.Duration(20-i) * 100 * time.Microsecond)
+
+				return i%3 == 0
+			})
+
+			if judged != tt.Expected {
+				t.Fatalf("Expected %d workloads to be judged, got %d", tt.Expected, judged)
+			}
+			for i, failing := range results {
+				if failing != (i%3 == 0 && !tt.Cancelled) {
+					t.Fatalf("Expected results in the order given, got %v", results)
+				}
+			}
+		})
+	}
+}
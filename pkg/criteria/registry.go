@@ -0,0 +1,163 @@
+package criteria
+
+import (
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
+	"github.com/nais/babylon/pkg/deployment"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/strings/slices"
+)
+
+// Scope decides what a Rule is evaluated against, and how its verdicts are aggregated.
+type Scope int
+
+const (
+	// PodScope rules are evaluated once per pod, a ReplicaSet or StatefulSet revision is failing when all of its
+	// pods are.
+	PodScope Scope = iota
+	// ReplicaSetScope rules are evaluated once per ReplicaSet or StatefulSet revision, any verdict marks it as
+	// failing.
+	ReplicaSetScope
+	// DeploymentScope rules are evaluated once per Deployment, any verdict marks the Deployment as failing.
+	DeploymentScope
+)
+
+// Subject is the set of objects a Rule is evaluated against. Which fields are set depends on the Scope, and on
+// whether a Deployment, StatefulSet or CronJob is judged.
+type Subject struct {
+	Deployment  *appsv1.Deployment
+	ReplicaSets []appsv1.ReplicaSet
+	ReplicaSet  *appsv1.ReplicaSet
+	StatefulSet *appsv1.StatefulSet
+	Revision    *appsv1.ControllerRevision
+	Job         *batchv1.Job
+	Pods        []v1.Pod
+	Pod         *v1.Pod
+	// Policy governing the workload, if any.
+	Policy *babylon_nais_io_v1alpha1.BabylonPolicySpec
+}
+
+// name returns the name of the replicaset, statefulset revision or job the subject's pods belong to.
+func (s *Subject) name() string {
+	switch {
+	case s.ReplicaSet != nil:
+		return s.ReplicaSet.Name
+	case s.Revision != nil:
+		return s.Revision.Name
+	case s.Job != nil:
+		return s.Job.Name
+	default:
+		return ""
+	}
+}
+
+// isCurrent returns whether the subject is the current revision of its deployment or statefulset.
+func (s *Subject) isCurrent() bool {
+	switch {
+	case s.ReplicaSet != nil && s.Deployment != nil:
+		revision, ok := s.Deployment.Annotations[deployment.RevisionAnnotationKey]
+
+		return ok && s.ReplicaSet.Annotations[deployment.RevisionAnnotationKey] == revision
+	case s.Revision != nil && s.StatefulSet != nil:
+		return s.Revision.Name == s.StatefulSet.Status.UpdateRevision
+	default:
+		return false
+	}
+}
+
+// restartThreshold returns the restart threshold of the policy governing the subject, or the fallback.
+func (s *Subject) restartThreshold(fallback int32) int32 {
+	if s.Policy != nil && s.Policy.RestartThreshold != nil {
+		return *s.Policy.RestartThreshold
+	}
+
+	return fallback
+}
+
+// Verdict is the outcome of a Rule firing.
+type Verdict struct {
+	Rule    string
+	Reason  string
+	Message string
+	Details map[string]string
+	// ReportOnly verdicts are recorded in logs and metrics, but never mark the subject as failing on their own.
+	ReportOnly bool
+}
+
+type Rule interface {
+	// Name identifies the rule in configuration, e.g. DISABLED_RULES.
+	Name() string
+	Scope() Scope
+	// Evaluate returns a verdict if the subject is failing, otherwise nil.
+	Evaluate(subject *Subject) *Verdict
+}
+
+type RuleRegistry struct {
+	rules    []Rule
+	disabled map[string]bool
+}
+
+func NewRuleRegistry(disabled []string) *RuleRegistry {
+	r := &RuleRegistry{disabled: map[string]bool{}}
+	for _, name := range disabled {
+		if name == "" {
+			continue
+		}
+		r.disabled[name] = true
+	}
+
+	return r
+}
+
+// Register adds rules to the registry, rules are evaluated in the order they are registered.
+func (r *RuleRegistry) Register(rules ...Rule) {
+	r.rules = append(r.rules, rules...)
+}
+
+func (r *RuleRegistry) IsEnabled(name string) bool {
+	return !r.disabled[name]
+}
+
+// Rules returns all enabled rules for the given scope.
+func (r *RuleRegistry) Rules(scope Scope) []Rule {
+	var rules []Rule
+	for _, rule := range r.rules {
+		if rule.Scope() == scope && r.IsEnabled(rule.Name()) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// rulesFor returns the rules for the given scope enabled by the policy, or all enabled rules if there is none.
+func (r *RuleRegistry) rulesFor(scope Scope, policy *babylon_nais_io_v1alpha1.BabylonPolicySpec) []Rule {
+	if policy == nil {
+		return r.Rules(scope)
+	}
+
+	var rules []Rule
+	for _, rule := range r.rules {
+		name := rule.Name()
+		enabled := r.IsEnabled(name) && !slices.Contains(policy.DisabledRules, name) ||
+			slices.Contains(policy.EnabledRules, name)
+		if rule.Scope() == scope && enabled {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+func (r *RuleRegistry) evaluate(scope Scope, subject *Subject) []Verdict {
+	var verdicts []Verdict
+	for _, rule := range r.rulesFor(scope, subject.Policy) {
+		if verdict := rule.Evaluate(subject); verdict != nil {
+			verdict.Rule = rule.Name()
+			verdicts = append(verdicts, *verdict)
+		}
+	}
+
+	return verdicts
+}
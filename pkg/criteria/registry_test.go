@@ -0,0 +1,147 @@
+package criteria
+
+import (
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
+	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/deployment"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/strings/slices"
+	"testing"
+)
+
+type staticRule struct {
+	name   string
+	scope  Scope
+	reason string
+}
+
+func (r *staticRule) Name() string { return r.name }
+func (r *staticRule) Scope() Scope { return r.scope }
+
+func (r *staticRule) Evaluate(_ *Subject) *Verdict {
+	return &Verdict{Reason: r.reason}
+}
+
+func TestRuleRegistry_Rules(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name     string
+		Disabled []string
+		Scope    Scope
+		Expected []string
+	}{
+		{
+			Name:     "All rules enabled by default",
+			Disabled: []string{""},
+			Scope:    PodScope,
+			Expected: []string{"a", "b"},
+		},
+		{
+			Name:     "Disabled rules are not returned",
+			Disabled: []string{"a"},
+			Scope:    PodScope,
+			Expected: []string{"b"},
+		},
+		{
+			Name:     "Rules are filtered by scope",
+			Disabled: []string{},
+			Scope:    ReplicaSetScope,
+			Expected: []string{"c"},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			registry := NewRuleRegistry(tt.Disabled)
+			registry.Register(
+				&staticRule{name: "a", scope: PodScope},
+				&staticRule{name: "b", scope: PodScope},
+				&staticRule{name: "c", scope: ReplicaSetScope},
+			)
+
+			rules := registry.Rules(tt.Scope)
+			if len(rules) != len(tt.Expected) {
+				t.Fatalf("Expected rules %v, got %d rules", tt.Expected, len(rules))
+			}
+			for i, rule := range rules {
+				if rule.Name() != tt.Expected[i] {
+					t.Fatalf("Expected rule %s at position %d, got %s", tt.Expected[i], i, rule.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestCoreCriteriaJudge_DisabledRule(t *testing.T) {
+	t.Parallel()
+
+	pod := makePodWithState(metav1.ObjectMeta{Name: "failingpod"}, v1.PodStatus{
+		Phase: v1.PodPending,
+		ContainerStatuses: []v1.ContainerStatus{{State: v1.ContainerState{
+			Waiting: &v1.ContainerStateWaiting{Reason: deployment.ImagePullBackOff},
+		}}},
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.DisabledRules = []string{ImagePullBackOffRuleName}
+	cfg.MaxRestartsPerWindow = 0
+	judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+
+	if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+		t.Fatalf("Expected disabled rule not to fire, got %+v", verdict)
+	}
+
+	judge.Rules().Register(&staticRule{name: "site-specific", scope: PodScope, reason: "SiteSpecific"})
+	verdict := judge.evaluatePod(&Subject{Pod: &pod})
+	if verdict == nil || verdict.Rule != "site-specific" || verdict.Reason != "SiteSpecific" {
+		t.Fatalf("Expected site-specific rule to fire, got %+v", verdict)
+	}
+}
+
+func TestCoreCriteriaJudge_PolicyRules(t *testing.T) {
+	t.Parallel()
+
+	pod := makePodWithState(metav1.ObjectMeta{Name: "failingpod"}, v1.PodStatus{
+		Phase: v1.PodRunning,
+		ContainerStatuses: []v1.ContainerStatus{{
+			State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: deployment.CrashLoopBackOff}},
+			RestartCount: 50,
+		}},
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.DisabledRules = []string{ImagePullBackOffRuleName}
+	cfg.MaxRestartsPerWindow = 0
+	judge := NewCoreCriteriaJudge(&cfg, nil, nil, nil, nil, true)
+
+	if verdict := judge.evaluatePod(&Subject{Pod: &pod}); verdict != nil {
+		t.Fatalf("Expected pod below the global restart threshold not to fail, got %+v", verdict)
+	}
+
+	restartThreshold := int32(10)
+	policy := &babylon_nais_io_v1alpha1.BabylonPolicySpec{RestartThreshold: &restartThreshold}
+	if verdict := judge.evaluatePod(&Subject{Pod: &pod, Policy: policy}); verdict == nil {
+		t.Fatal("Expected pod above the policy's restart threshold to fail")
+	}
+
+	policy.DisabledRules = []string{CrashLoopBackOffRuleName}
+	if verdict := judge.evaluatePod(&Subject{Pod: &pod, Policy: policy}); verdict != nil {
+		t.Fatalf("Expected rule disabled by policy not to fire, got %+v", verdict)
+	}
+
+	policy.EnabledRules = []string{ImagePullBackOffRuleName}
+	rules := judge.Rules().rulesFor(PodScope, policy)
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule.Name())
+	}
+	if !slices.Contains(names, ImagePullBackOffRuleName) || slices.Contains(names, CrashLoopBackOffRuleName) {
+		t.Fatalf("Expected policy to enable %s and disable %s, got %v",
+			ImagePullBackOffRuleName, CrashLoopBackOffRuleName, names)
+	}
+}
@@ -0,0 +1,130 @@
+package criteria
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type containerKey struct {
+	pod       types.UID
+	container string
+}
+
+// restartObservation is the last observed restart count of a container, its restart rate at the time, and for how
+// many consecutive observations its restart rate has been too high.
+type restartObservation struct {
+	restartCount int32
+	observedAt   time.Time
+	rate         float64
+	consecutive  int
+}
+
+// restartTracker remembers the restart counts of containers across ticks, so that restart rates can be computed
+// between observations rather than over the entire lifetime of a pod. Pods are judged both by the reconciler, on
+// every change, and by the periodic resync, so observations are at least minInterval apart: a single restart
+// between two reconciles seconds apart would otherwise extrapolate to hundreds per window.
+type restartTracker struct {
+	mu           sync.Mutex
+	window       time.Duration
+	minInterval  time.Duration
+	maxRestarts  int
+	observations map[containerKey]restartObservation
+	lastPruned   time.Time
+	now          func() time.Time
+}
+
+func newRestartTracker(window, minInterval time.Duration, maxRestarts int) *restartTracker {
+	return &restartTracker{
+		window:       window,
+		minInterval:  minInterval,
+		maxRestarts:  maxRestarts,
+		observations: map[containerKey]restartObservation{},
+		now:          time.Now,
+	}
+}
+
+// enabled returns whether a restart rate is configured, otherwise only the absolute restart threshold applies.
+func (t *restartTracker) enabled() bool {
+	return t.window > 0 && t.maxRestarts > 0
+}
+
+// exceeded observes the restart count of a container, and returns its restart rate per window and whether the rate
+// has exceeded the maximum for the given number of consecutive observations. It is never exceeded when the restart
+// rate is disabled.
+func (t *restartTracker) exceeded(pod *v1.Pod, status *v1.ContainerStatus, observations int) (float64, bool) {
+	if !t.enabled() {
+		return 0, false
+	}
+
+	rate, consecutive := t.observe(pod, status)
+	log.Tracef("Pod: %s container %s restarting %.1f times per %v, %d consecutive observations",
+		pod.Name, status.Name, rate, t.window, consecutive)
+
+	return rate, consecutive >= observations
+}
+
+// observe records the restart count of a container, and returns its restart rate per window along with the number
+// of consecutive observations the rate has exceeded the maximum. Within minInterval of the previous observation,
+// the previous result is returned without recording a new observation.
+func (t *restartTracker) observe(pod *v1.Pod, status *v1.ContainerStatus) (float64, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+
+	key := containerKey{pod: pod.UID, container: status.Name}
+	previous, ok := t.observations[key]
+	if ok && status.RestartCount >= previous.restartCount && now.Sub(previous.observedAt) < t.minInterval {
+		return previous.rate, previous.consecutive
+	}
+
+	var elapsed time.Duration
+	var restarts int32
+	switch {
+	case ok && status.RestartCount >= previous.restartCount && now.After(previous.observedAt):
+		elapsed, restarts = now.Sub(previous.observedAt), status.RestartCount-previous.restartCount
+	case pod.Status.StartTime != nil:
+		elapsed, restarts = now.Sub(pod.Status.StartTime.Time), status.RestartCount
+		previous = restartObservation{}
+		// a young pod restarting a few times is measured against a full window, rather than extrapolated
+		if elapsed < t.window {
+			elapsed = t.window
+		}
+	default:
+		// without a start time, the first observation is the baseline the next one is measured against
+		t.observations[key] = restartObservation{restartCount: status.RestartCount, observedAt: now}
+
+		return 0, 0
+	}
+
+	rate := float64(restarts) / elapsed.Hours() * t.window.Hours()
+
+	consecutive := 0
+	if rate > float64(t.maxRestarts) {
+		consecutive = previous.consecutive + 1
+	}
+	t.observations[key] = restartObservation{
+		restartCount: status.RestartCount, observedAt: now, rate: rate, consecutive: consecutive,
+	}
+
+	return rate, consecutive
+}
+
+// prune forgets containers that have not been observed for a couple of windows, e.g. as their pods are gone.
+func (t *restartTracker) prune(now time.Time) {
+	if now.Sub(t.lastPruned) < t.window {
+		return
+	}
+	t.lastPruned = now
+
+	for key, observation := range t.observations {
+		if now.Sub(observation.observedAt) > 2*t.window {
+			delete(t.observations, key)
+		}
+	}
+}
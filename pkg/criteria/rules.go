@@ -0,0 +1,429 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/deployment"
+	"github.com/nais/babylon/pkg/events"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	OOMKilledRuleName                  = "oom-killed"
+	ContainerErrorRuleName             = "container-error"
+	CrashLoopBackOffRuleName           = "crash-loop-back-off"
+	ImagePullBackOffRuleName           = "image-pull-back-off"
+	CreateContainerConfigErrorRuleName = "create-container-config-error"
+	InitContainerFailedRuleName        = "init-container-failed"
+	PodFailedRuleName                  = "pod-failed"
+	UnschedulableRuleName              = "unschedulable"
+	NeverReadyRuleName                 = "never-ready"
+	ProgressDeadlineExceededRuleName   = "progress-deadline-exceeded"
+	EventRuleName                      = "event"
+)
+
+// DefaultRuleRegistry returns a registry containing all built-in rules, minus the ones disabled in config.
+func DefaultRuleRegistry(cfg *config.Config) *RuleRegistry {
+	registry := NewRuleRegistry(cfg.DisabledRules)
+	restarts := newRestartTracker(cfg.RestartRateWindow, cfg.TickRate, cfg.MaxRestartsPerWindow)
+	registry.Register(
+		&oomKilledRule{
+			restartThreshold: cfg.RestartThreshold,
+			restarts:         restarts,
+			observations:     cfg.RestartRateObservations,
+		},
+		&containerErrorRule{},
+		&crashLoopBackOffRule{
+			restartThreshold: cfg.RestartThreshold,
+			restarts:         restarts,
+			observations:     cfg.RestartRateObservations,
+		},
+		&imagePullBackOffRule{},
+		&createContainerConfigErrorRule{},
+		&initContainerFailedRule{restartThreshold: cfg.RestartThreshold},
+		&podFailedRule{policies: cfg.FailedPodPolicies},
+		&unschedulableRule{after: cfg.UnschedulableAfter},
+		&neverReadyRule{maxUnready: cfg.MaxUnready},
+		&progressDeadlineExceededRule{},
+	)
+
+	return registry
+}
+
+type oomKilledRule struct {
+	restartThreshold int32
+	restarts         *restartTracker
+	observations     int
+}
+
+func (r *oomKilledRule) Name() string { return OOMKilledRuleName }
+func (r *oomKilledRule) Scope() Scope { return PodScope }
+
+func (r *oomKilledRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Pod.Status.Phase != v1.PodRunning {
+		return nil
+	}
+
+	// restarting too often, or past the restart threshold, like crash-loop-back-off
+	restartThreshold := subject.restartThreshold(r.restartThreshold)
+	var status *v1.ContainerStatus
+	for i := range subject.Pod.Status.ContainerStatuses {
+		candidate := &subject.Pod.Status.ContainerStatuses[i]
+		if !deployment.IsOOMKilledCrashLoop(candidate) {
+			continue
+		}
+		if _, exceeded := r.restarts.exceeded(subject.Pod, candidate, r.observations); exceeded ||
+			candidate.RestartCount > restartThreshold {
+			status = candidate
+
+			break
+		}
+	}
+	if status == nil {
+		return nil
+	}
+
+	memoryLimit := "none"
+	for _, container := range subject.Pod.Spec.Containers {
+		if limit, ok := container.Resources.Limits[v1.ResourceMemory]; container.Name == status.Name && ok {
+			memoryLimit = limit.String()
+		}
+	}
+
+	return &Verdict{
+		Reason: deployment.OOMKilled,
+		Message: fmt.Sprintf("container %s has been OOMKilled and restarted %d times with memory limit %s, "+
+			"consider raising the memory limit", status.Name, status.RestartCount, memoryLimit),
+		Details: map[string]string{
+			"container":     status.Name,
+			"memory_limit":  memoryLimit,
+			"restart_count": strconv.Itoa(int(status.RestartCount)),
+		},
+	}
+}
+
+type containerErrorRule struct{}
+
+func (r *containerErrorRule) Name() string { return ContainerErrorRuleName }
+func (r *containerErrorRule) Scope() Scope { return PodScope }
+
+func (r *containerErrorRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Pod.Status.Phase != v1.PodPending && subject.Pod.Status.Phase != v1.PodRunning {
+		return nil
+	}
+
+	if reason, failing := deployment.GetContainerError(subject.Pod.Status.ContainerStatuses); failing {
+		return &Verdict{Reason: reason}
+	}
+
+	return nil
+}
+
+type crashLoopBackOffRule struct {
+	restartThreshold int32
+	restarts         *restartTracker
+	observations     int
+}
+
+func (r *crashLoopBackOffRule) Name() string { return CrashLoopBackOffRuleName }
+func (r *crashLoopBackOffRule) Scope() Scope { return PodScope }
+
+func (r *crashLoopBackOffRule) Evaluate(subject *Subject) *Verdict {
+	// a pod with crash looping init containers, including native sidecars, is still pending
+	if subject.Pod.Status.Phase != v1.PodRunning && subject.Pod.Status.Phase != v1.PodPending {
+		return nil
+	}
+	log.Tracef("Pod: %s %s", subject.Pod.Name, subject.Pod.Status.Phase)
+
+	statuses := make([]v1.ContainerStatus, 0,
+		len(subject.Pod.Status.InitContainerStatuses)+len(subject.Pod.Status.ContainerStatuses))
+	statuses = append(statuses, subject.Pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, subject.Pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		status := &statuses[i]
+		waiting := status.State.Waiting
+		if waiting == nil || waiting.Reason != deployment.CrashLoopBackOff {
+			continue
+		}
+
+		rate, exceeded := r.restarts.exceeded(subject.Pod, status, r.observations)
+		if !exceeded {
+			continue
+		}
+
+		return &Verdict{
+			Reason: deployment.CrashLoopBackOff,
+			Message: fmt.Sprintf("container %s is restarting %.1f times per %v", status.Name, rate,
+				r.restarts.window),
+			Details: map[string]string{
+				"container":     status.Name,
+				"restart_rate":  strconv.FormatFloat(rate, 'f', 1, 64),
+				"restart_count": strconv.Itoa(int(status.RestartCount)),
+			},
+		}
+	}
+
+	// the restart count over the lifetime of the pod is the fallback, e.g. for pods without a start time
+	restartThreshold := subject.restartThreshold(r.restartThreshold)
+	if deployment.IsContainerCrashLoopBackOff(restartThreshold, subject.Pod.Status.ContainerStatuses) {
+		return &Verdict{Reason: deployment.CrashLoopBackOff}
+	}
+
+	return nil
+}
+
+type imagePullBackOffRule struct{}
+
+func (r *imagePullBackOffRule) Name() string { return ImagePullBackOffRuleName }
+func (r *imagePullBackOffRule) Scope() Scope { return PodScope }
+
+func (r *imagePullBackOffRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Pod.Status.Phase != v1.PodPending {
+		return nil
+	}
+	log.Tracef("Pod: %s pending", subject.Pod.Name)
+
+	if deployment.IsContainerImageCheckFail(subject.Pod.Status.ContainerStatuses) {
+		return &Verdict{Reason: deployment.ImagePullBackOff}
+	}
+
+	return nil
+}
+
+type createContainerConfigErrorRule struct{}
+
+func (r *createContainerConfigErrorRule) Name() string { return CreateContainerConfigErrorRuleName }
+func (r *createContainerConfigErrorRule) Scope() Scope { return PodScope }
+
+func (r *createContainerConfigErrorRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Pod.Status.Phase != v1.PodPending {
+		return nil
+	}
+
+	if deployment.IsCreateContainerConfigError(subject.Pod.Status.ContainerStatuses) {
+		return &Verdict{Reason: deployment.CreateContainerConfigError}
+	}
+
+	return nil
+}
+
+type initContainerFailedRule struct {
+	restartThreshold int32
+}
+
+func (r *initContainerFailedRule) Name() string { return InitContainerFailedRuleName }
+func (r *initContainerFailedRule) Scope() Scope { return ReplicaSetScope }
+
+func (r *initContainerFailedRule) Evaluate(subject *Subject) *Verdict {
+	restartThreshold := subject.restartThreshold(r.restartThreshold)
+	for i := range subject.Pods {
+		if failing, reason := deployment.IsInitContainerFailed(
+			restartThreshold,
+			subject.Pods[i].Status.InitContainerStatuses); failing {
+			log.Infof("Init container failing for %s due to %s", subject.name(), reason)
+
+			return &Verdict{Reason: reason, Message: "init container failing in pod " + subject.Pods[i].Name}
+		}
+	}
+
+	return nil
+}
+
+type podFailedRule struct {
+	policies map[string]string
+}
+
+func (r *podFailedRule) Name() string { return PodFailedRuleName }
+func (r *podFailedRule) Scope() Scope { return PodScope }
+
+func (r *podFailedRule) Evaluate(subject *Subject) *Verdict {
+	reason, ok := deployment.GetPodFailedReason(subject.Pod)
+	if !ok {
+		return nil
+	}
+	log.Tracef("Pod: %s failed due to %s", subject.Pod.Name, reason)
+
+	policy, ok := r.policies[reason]
+	if !ok {
+		policy = config.PolicyCount
+	}
+
+	switch policy {
+	case config.PolicyIgnore:
+		return nil
+	case config.PolicyReport:
+		return &Verdict{Reason: reason, Message: subject.Pod.Status.Message, ReportOnly: true}
+	default:
+		return &Verdict{Reason: reason, Message: subject.Pod.Status.Message}
+	}
+}
+
+type unschedulableRule struct {
+	after time.Duration
+}
+
+func (r *unschedulableRule) Name() string { return UnschedulableRuleName }
+func (r *unschedulableRule) Scope() Scope { return PodScope }
+
+func (r *unschedulableRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Pod.Status.Phase != v1.PodPending {
+		return nil
+	}
+
+	condition := deployment.GetUnschedulableCondition(subject.Pod)
+	if condition == nil {
+		return nil
+	}
+
+	unschedulableFor := time.Since(condition.LastTransitionTime.Time)
+	if unschedulableFor < r.after {
+		log.Tracef("Pod: %s unschedulable for %v, not yet failing", subject.Pod.Name, unschedulableFor)
+
+		return nil
+	}
+
+	return &Verdict{
+		Reason:  deployment.Unschedulable,
+		Message: condition.Message,
+		Details: map[string]string{"unschedulable_for": unschedulableFor.Round(time.Second).String()},
+	}
+}
+
+type neverReadyRule struct {
+	maxUnready time.Duration
+}
+
+func (r *neverReadyRule) Name() string { return NeverReadyRuleName }
+func (r *neverReadyRule) Scope() Scope { return PodScope }
+
+func (r *neverReadyRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Pod.Status.Phase != v1.PodRunning {
+		return nil
+	}
+
+	condition := deployment.GetUnreadyCondition(subject.Pod)
+	if condition == nil {
+		return nil
+	}
+
+	containers := deployment.GetUnreadyContainers(subject.Pod)
+	if len(containers) == 0 {
+		return nil
+	}
+
+	maxUnready := r.maxUnready
+	if subject.Deployment != nil {
+		maxUnready += time.Duration(subject.Deployment.Spec.MinReadySeconds) * time.Second
+	}
+
+	unreadyFor := time.Since(condition.LastTransitionTime.Time)
+	if unreadyFor < maxUnready {
+		log.Tracef("Pod: %s unready for %v, not yet failing", subject.Pod.Name, unreadyFor)
+
+		return nil
+	}
+
+	return &Verdict{
+		Reason:  deployment.NeverReady,
+		Message: fmt.Sprintf("containers %v have not passed their readiness probes for %v", containers, unreadyFor),
+		Details: map[string]string{"unready_for": unreadyFor.Round(time.Second).String()},
+	}
+}
+
+type progressDeadlineExceededRule struct{}
+
+func (r *progressDeadlineExceededRule) Name() string { return ProgressDeadlineExceededRuleName }
+func (r *progressDeadlineExceededRule) Scope() Scope { return DeploymentScope }
+
+func (r *progressDeadlineExceededRule) Evaluate(subject *Subject) *Verdict {
+	if subject.Deployment == nil || subject.Deployment.Spec.Paused {
+		return nil
+	}
+
+	condition := deployment.GetProgressDeadlineExceededCondition(subject.Deployment)
+	if condition == nil {
+		return nil
+	}
+
+	newReplicaSet := deployment.GetNewReplicaSet(subject.Deployment, subject.ReplicaSets)
+	if newReplicaSet == nil {
+		log.Debugf("Deployment %s exceeded its progress deadline, but has no new replicaset",
+			subject.Deployment.Name)
+
+		return nil
+	}
+
+	if !strings.Contains(condition.Message, newReplicaSet.Name) {
+		log.Debugf("Deployment %s progress deadline condition does not concern new replicaset %s: %s",
+			subject.Deployment.Name, newReplicaSet.Name, condition.Message)
+
+		return nil
+	}
+
+	return &Verdict{
+		Reason:  deployment.ProgressDeadlineExceeded,
+		Message: condition.Message,
+		Details: map[string]string{
+			"replicaset": newReplicaSet.Name,
+			"revision":   newReplicaSet.Annotations[deployment.RevisionAnnotationKey],
+		},
+	}
+}
+
+// NewEventRules returns rules failing pods, replicasets and deployments with recent warning events, which have
+// occurred at least minCount times.
+func NewEventRules(watcher *events.Watcher, minCount int32) []Rule {
+	return []Rule{
+		&eventRule{scope: PodScope, watcher: watcher, minCount: minCount},
+		&eventRule{scope: ReplicaSetScope, watcher: watcher, minCount: minCount},
+		&eventRule{scope: DeploymentScope, watcher: watcher, minCount: minCount},
+	}
+}
+
+type eventRule struct {
+	scope    Scope
+	watcher  *events.Watcher
+	minCount int32
+}
+
+func (r *eventRule) Name() string { return EventRuleName }
+func (r *eventRule) Scope() Scope { return r.scope }
+
+func (r *eventRule) Evaluate(subject *Subject) *Verdict {
+	var uid types.UID
+	switch {
+	case r.scope == PodScope:
+		uid = subject.Pod.UID
+	case r.scope == ReplicaSetScope && subject.ReplicaSet != nil:
+		uid = subject.ReplicaSet.UID
+	case r.scope == ReplicaSetScope && subject.StatefulSet != nil:
+		uid = subject.StatefulSet.UID
+	case r.scope == DeploymentScope && subject.Deployment != nil:
+		uid = subject.Deployment.UID
+	default:
+		return nil
+	}
+
+	for _, signal := range r.watcher.Signals(uid) {
+		if signal.Count < r.minCount {
+			continue
+		}
+
+		return &Verdict{
+			Reason:  signal.Reason,
+			Message: signal.LastMessage,
+			Details: map[string]string{
+				"event_count":     strconv.Itoa(int(signal.Count)),
+				"event_last_seen": signal.LastSeen.Format(time.RFC3339),
+			},
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package criteria
+
+import (
+	"path"
+
+	"github.com/nais/babylon/pkg/deployment"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/strings/slices"
+)
+
+// sidecars separates well-known sidecar containers, e.g. linkerd-proxy, from the app containers of a pod, so that
+// a failing sidecar neither gets the app rolled back nor hides a failing app.
+type sidecars struct {
+	patterns []string
+	policy   string
+}
+
+func (s *sidecars) isSidecar(name string) bool {
+	for _, pattern := range s.patterns {
+		if matched, err := path.Match(pattern, name); err != nil {
+			log.Warnf("invalid sidecar pattern %s: %v", pattern, err)
+		} else if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// split returns a copy of the pod with only its app containers, and a copy with only its sidecars, including
+// native sidecars which are moved to the regular containers. The sidecar copy is nil if the pod has no sidecars.
+func (s *sidecars) split(pod *v1.Pod) (*v1.Pod, *v1.Pod) {
+	native := deployment.GetNativeSidecars(pod)
+	// containers are matched by name first, as a crash looping native sidecar may not be recognizable by status
+	isSidecar := func(name string) bool { return s.isSidecar(name) || slices.Contains(native, name) }
+
+	app := pod.DeepCopy()
+	infra := pod.DeepCopy()
+	app.Spec.Containers, infra.Spec.Containers = nil, nil
+	app.Spec.InitContainers, infra.Spec.InitContainers = nil, nil
+	app.Status.ContainerStatuses, infra.Status.ContainerStatuses = nil, nil
+	app.Status.InitContainerStatuses, infra.Status.InitContainerStatuses = nil, nil
+
+	for _, container := range pod.Spec.Containers {
+		if isSidecar(container.Name) {
+			infra.Spec.Containers = append(infra.Spec.Containers, container)
+		} else {
+			app.Spec.Containers = append(app.Spec.Containers, container)
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		if isSidecar(container.Name) {
+			infra.Spec.Containers = append(infra.Spec.Containers, container)
+		} else {
+			app.Spec.InitContainers = append(app.Spec.InitContainers, container)
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if isSidecar(status.Name) {
+			infra.Status.ContainerStatuses = append(infra.Status.ContainerStatuses, status)
+		} else {
+			app.Status.ContainerStatuses = append(app.Status.ContainerStatuses, status)
+		}
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if isSidecar(status.Name) {
+			infra.Status.ContainerStatuses = append(infra.Status.ContainerStatuses, status)
+		} else {
+			app.Status.InitContainerStatuses = append(app.Status.InitContainerStatuses, status)
+		}
+	}
+
+	if len(infra.Status.ContainerStatuses) == 0 {
+		return app, nil
+	}
+
+	return app, infra
+}
+
+// appPods returns copies of the pods with only their app containers.
+func (s *sidecars) appPods(pods []v1.Pod) []v1.Pod {
+	apps := make([]v1.Pod, 0, len(pods))
+	for i := range pods {
+		app, _ := s.split(&pods[i])
+		apps = append(apps, *app)
+	}
+
+	return apps
+}
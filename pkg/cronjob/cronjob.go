@@ -0,0 +1,124 @@
+package cronjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/nais/babylon/pkg/deployment"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var ErrFetchJobsFailed = errors.New("failed to fetch jobs")
+
+const controllerUIDLabelKey = "controller-uid"
+
+// GetJobsByCronJob returns the jobs owned by the cronjob, newest first.
+func GetJobsByCronJob(ctx context.Context, c client.Client, cronJob *batchv1.CronJob) ([]batchv1.Job, error) {
+	var jobList batchv1.JobList
+	err := c.List(ctx, &jobList, &client.ListOptions{Namespace: cronJob.Namespace})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchJobsFailed, err)
+	}
+
+	var jobs []batchv1.Job
+	for i := range jobList.Items {
+		if metav1.IsControlledBy(&jobList.Items[i], cronJob) {
+			jobs = append(jobs, jobList.Items[i])
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[j].CreationTimestamp.Before(&jobs[i].CreationTimestamp)
+	})
+
+	return jobs, nil
+}
+
+func GetPodsFromJob(ctx context.Context, c client.Client, job *batchv1.Job) ([]v1.Pod, error) {
+	labelSelector := labels.Set{controllerUIDLabelKey: string(job.UID)}
+	podList := &v1.PodList{}
+	err := c.List(ctx, podList, &client.ListOptions{LabelSelector: labelSelector.AsSelector(), Namespace: job.Namespace})
+	if err != nil {
+		return nil, fmt.Errorf("could not get pods from job: %w", err)
+	}
+
+	var pods []v1.Pod
+	for i := range podList.Items {
+		if metav1.IsControlledBy(&podList.Items[i], job) {
+			pods = append(pods, podList.Items[i])
+		}
+	}
+
+	return pods, nil
+}
+
+// GetFailedCondition returns the Failed condition of a job, or nil if the job has not failed.
+func GetFailedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Type == batchv1.JobFailed && condition.Status == v1.ConditionTrue {
+			return condition
+		}
+	}
+
+	return nil
+}
+
+func isFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultFailedJobsHistoryLimit is the number of failed jobs kept by a cronjob without a failedJobsHistoryLimit.
+const defaultFailedJobsHistoryLimit = 1
+
+// CapFailedJobsThreshold caps the number of consecutive failed jobs that fail the cronjob at the number of failed
+// jobs it keeps, as more can never be observed. At least one failed job is required.
+func CapFailedJobsThreshold(cronJob *batchv1.CronJob, threshold int) int {
+	limit := defaultFailedJobsHistoryLimit
+	if cronJob.Spec.FailedJobsHistoryLimit != nil {
+		limit = int(*cronJob.Spec.FailedJobsHistoryLimit)
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if threshold > limit {
+		return limit
+	}
+
+	return threshold
+}
+
+// CountConsecutiveFailedJobs counts failed jobs from the newest finished job, until the first job that did not fail.
+// Returns the count and the reason the most recent job failed.
+func CountConsecutiveFailedJobs(jobs []batchv1.Job) (int, string) {
+	failed := 0
+	reason := deployment.Unknown
+	for i := range jobs {
+		if !isFinished(&jobs[i]) {
+			continue
+		}
+
+		condition := GetFailedCondition(&jobs[i])
+		if condition == nil {
+			break
+		}
+		if failed == 0 && condition.Reason != "" {
+			reason = condition.Reason
+		}
+		failed++
+	}
+
+	return failed, reason
+}
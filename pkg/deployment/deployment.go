@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/nais/babylon/pkg/config"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/strings/slices"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -18,6 +21,7 @@ var (
 	ErrPatchFailed              = errors.New("failed to apply patch")
 	ErrFetchReplicasetFailed    = errors.New("failed to fetch replicasets")
 	ErrNoRollbackCandidateFound = errors.New("no rollback candidate found")
+	ErrAlreadyRolledBack        = errors.New("already has the template of the rollback candidate")
 )
 
 const (
@@ -26,11 +30,40 @@ const (
 	ErrImagePull               = "ErrImagePull"
 	CrashLoopBackOff           = "CrashLoopBackOff"
 	CreateContainerConfigError = "CreateContainerConfigError"
+	CreateContainerError       = "CreateContainerError"
+	InvalidImageName           = "InvalidImageName"
+	RunContainerError          = "RunContainerError"
+	ContainerCannotRun         = "ContainerCannotRun"
+	OOMKilled                  = "OOMKilled"
+	Evicted                    = "Evicted"
+	DeadlineExceeded           = "DeadlineExceeded"
+	NodeLost                   = "NodeLost"
+	UnexpectedAdmissionError   = "UnexpectedAdmissionError"
+	Unschedulable              = "Unschedulable"
+	NeverReady                 = "NeverReady"
+	ProgressDeadlineExceeded   = "ProgressDeadlineExceeded"
+	JobFailed                  = "JobFailed"
+	Infrastructure             = "Infrastructure"
 	RollbackCauseAnnotation    = "rolled back by babylon"
 	DownscaleCauseAnnotation   = "scaled down by babylon"
+	SuspendCauseAnnotation     = "suspended by babylon"
+	PauseCauseAnnotation       = "paused by babylon"
 	ChangeCauseAnnotationKey   = "kubernetes.io/change-cause"
+	RevisionAnnotationKey      = "deployment.kubernetes.io/revision"
+	OwnerUIDField              = "metadata.ownerReferences.controller.uid"
 )
 
+// annotationsToSkip are kept on the deployment when rolling back, rather than copied from the replicaset, like
+// kubectl rollout undo does.
+var annotationsToSkip = map[string]bool{
+	v1.LastAppliedConfigAnnotation:              true,
+	RevisionAnnotationKey:                       true,
+	"deployment.kubernetes.io/revision-history": true,
+	"deployment.kubernetes.io/desired-replicas": true,
+	"deployment.kubernetes.io/max-replicas":     true,
+	appsv1.DeprecatedRollbackTo:                 true,
+}
+
 func IsCreateContainerConfigError(containers []v1.ContainerStatus) bool {
 	for _, containerStatus := range containers {
 		waiting := containerStatus.State.Waiting
@@ -74,46 +107,299 @@ func IsContainerCrashLoopBackOff(restartThreshold int32, containers []v1.Contain
 	return false
 }
 
+// GetOOMKilledContainer returns the first container crash looping past the restart threshold due to running
+// out of memory, or nil if there is none.
+func GetOOMKilledContainer(restartThreshold int32, containers []v1.ContainerStatus) *v1.ContainerStatus {
+	for i := range containers {
+		if IsOOMKilledCrashLoop(&containers[i]) && containers[i].RestartCount > restartThreshold {
+			return &containers[i]
+		}
+	}
+
+	return nil
+}
+
+// IsOOMKilledCrashLoop returns whether the container is crash looping, having last terminated due to running out of
+// memory, regardless of how many times it has restarted.
+func IsOOMKilledCrashLoop(container *v1.ContainerStatus) bool {
+	waiting := container.State.Waiting
+	terminated := container.LastTerminationState.Terminated
+	if waiting == nil || terminated == nil {
+		return false
+	}
+	log.Tracef("Waiting (IsOOMKilledCrashLoop): %+v, last terminated: %+v", waiting, terminated)
+
+	return waiting.Reason == CrashLoopBackOff && terminated.Reason == OOMKilled
+}
+
+// GetPodFailedReason classifies a pod in phase Failed by its status reason, returns false if the reason is not known.
+func GetPodFailedReason(pod *v1.Pod) (string, bool) {
+	if pod.Status.Phase != v1.PodFailed {
+		return "", false
+	}
+
+	switch pod.Status.Reason {
+	case Evicted, DeadlineExceeded, NodeLost, UnexpectedAdmissionError:
+		return pod.Status.Reason, true
+	default:
+		log.Tracef("Pod %s failed with unknown reason %s", pod.Name, pod.Status.Reason)
+
+		return "", false
+	}
+}
+
+// GetUnschedulableCondition returns the PodScheduled condition if the scheduler has deemed the pod
+// unschedulable, otherwise nil.
+func GetUnschedulableCondition(pod *v1.Pod) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		condition := &pod.Status.Conditions[i]
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse &&
+			condition.Reason == v1.PodReasonUnschedulable {
+			return condition
+		}
+	}
+
+	return nil
+}
+
+// GetUnreadyCondition returns the Ready condition if the pod is not ready, otherwise nil.
+func GetUnreadyCondition(pod *v1.Pod) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		condition := &pod.Status.Conditions[i]
+		if condition.Type == v1.PodReady && condition.Status == v1.ConditionFalse {
+			return condition
+		}
+	}
+
+	return nil
+}
+
+// GetUnreadyContainers returns the names of containers with a readiness probe that are not ready.
+func GetUnreadyContainers(pod *v1.Pod) []string {
+	probed := map[string]bool{}
+	for _, container := range pod.Spec.Containers {
+		probed[container.Name] = container.ReadinessProbe != nil
+	}
+
+	var unready []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if probed[status.Name] && !status.Ready {
+			unready = append(unready, status.Name)
+		}
+	}
+
+	return unready
+}
+
+// GetContainerError returns the reason of the first container that cannot be created or started, regardless of
+// the number of restarts.
+func GetContainerError(containers []v1.ContainerStatus) (string, bool) {
+	for _, container := range containers {
+		waiting := container.State.Waiting
+		if waiting != nil {
+			log.Tracef("Waiting (GetContainerError): %+v", waiting)
+
+			switch waiting.Reason {
+			case CreateContainerError, InvalidImageName, RunContainerError:
+				return waiting.Reason, true
+			}
+		}
+
+		if container.State.Running != nil {
+			continue
+		}
+		for _, terminated := range []*v1.ContainerStateTerminated{
+			container.State.Terminated, container.LastTerminationState.Terminated} {
+			if terminated != nil && terminated.Reason == ContainerCannotRun {
+				return ContainerCannotRun, true
+			}
+		}
+	}
+
+	return "", false
+}
+
 func IsInitContainerFailed(restartThreshold int32, initContainers []v1.ContainerStatus) (bool, string) {
-	if IsContainerCrashLoopBackOff(restartThreshold, initContainers) {
+	if reason, failing := GetContainerError(initContainers); failing {
+		return true, reason
+	} else if IsContainerCrashLoopBackOff(restartThreshold, initContainers) {
 		return true, CrashLoopBackOff
 	} else if IsContainerImageCheckFail(initContainers) {
 		return true, ImagePullBackOff
+	} else if IsCreateContainerConfigError(initContainers) {
+		return true, CreateContainerConfigError
 	}
 
 	return false, ""
 }
 
+// GetProgressDeadlineExceededCondition returns the Progressing condition if the deployment has exceeded its
+// progress deadline, otherwise nil.
+func GetProgressDeadlineExceededCondition(deploy *appsv1.Deployment) *appsv1.DeploymentCondition {
+	for i := range deploy.Status.Conditions {
+		condition := &deploy.Status.Conditions[i]
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == v1.ConditionFalse &&
+			condition.Reason == ProgressDeadlineExceeded {
+			return condition
+		}
+	}
+
+	return nil
+}
+
+// GetRevision returns the revision of the replicaset, or 0 if it has none.
+func GetRevision(rs metav1.Object) int64 {
+	revision, err := strconv.ParseInt(rs.GetAnnotations()[RevisionAnnotationKey], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return revision
+}
+
+// IsRolledOut returns whether all replicas of the deployment are updated to its current revision and available.
+func IsRolledOut(deploy *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	status := deploy.Status
+
+	return status.ObservedGeneration >= deploy.Generation && status.Replicas == replicas &&
+		status.UpdatedReplicas == replicas && status.AvailableReplicas == replicas
+}
+
+// GetNewReplicaSet returns the replica set matching the deployment's current revision, or nil if there is none.
+func GetNewReplicaSet(deploy *appsv1.Deployment, replicaSets []appsv1.ReplicaSet) *appsv1.ReplicaSet {
+	revision, ok := deploy.Annotations[RevisionAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	for i := range replicaSets {
+		if replicaSets[i].Annotations[RevisionAnnotationKey] == revision {
+			return &replicaSets[i]
+		}
+	}
+
+	return nil
+}
+
+// EqualIgnoreHash returns whether the pod templates are equal, disregarding the pod-template-hash label. This is how
+// the deployment controller finds the replicaset of its template.
+func EqualIgnoreHash(template1, template2 *v1.PodTemplateSpec) bool {
+	t1, t2 := template1.DeepCopy(), template2.DeepCopy()
+	delete(t1.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	delete(t2.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+	return equality.Semantic.DeepEqual(t1, t2)
+}
+
+// RollbackTo sets the pod template and annotations of the deployment to those of the replicaset, like kubectl
+// rollout undo, so that the deployment controller adopts the replicaset rather than creating a new one. The revision
+// annotations, and those of babylon, are kept. It returns false if the deployment already has the template.
+func RollbackTo(deploy *appsv1.Deployment, rs *appsv1.ReplicaSet) bool {
+	if EqualIgnoreHash(&deploy.Spec.Template, &rs.Spec.Template) {
+		return false
+	}
+
+	template := rs.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	deploy.Spec.Template = *template
+
+	annotations := map[string]string{}
+	for k, v := range deploy.Annotations {
+		if annotationsToSkip[k] || strings.HasPrefix(k, config.AnnotationPrefix) {
+			annotations[k] = v
+		}
+	}
+	for k, v := range rs.Annotations {
+		if !annotationsToSkip[k] && !strings.HasPrefix(k, config.AnnotationPrefix) {
+			annotations[k] = v
+		}
+	}
+	deploy.Annotations = annotations
+
+	return true
+}
+
+// IndexOwners registers the field indexes GetReplicaSetsByDeployment and GetPodsFromReplicaSet use to look up
+// replicasets and pods by the UID of their controller.
+func IndexOwners(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, obj := range []client.Object{&appsv1.ReplicaSet{}, &v1.Pod{}} {
+		err := indexer.IndexField(ctx, obj, OwnerUIDField, controllerUID)
+		if err != nil {
+			return fmt.Errorf("could not index %T by owner: %w", obj, err)
+		}
+	}
+
+	return nil
+}
+
+func controllerUID(obj client.Object) []string {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		return nil
+	}
+
+	return []string{string(owner.UID)}
+}
+
+// GetReplicaSetsByDeployment returns the replicasets controlled by the deployment. Ownership is resolved through
+// owner references rather than labels, as selectors of deployments in the same namespace may overlap.
 func GetReplicaSetsByDeployment(ctx context.Context,
 	c client.Client,
 	deployment *appsv1.Deployment) (appsv1.ReplicaSetList, error) {
-	labelSelector := labels.Set(deployment.Spec.Selector.MatchLabels)
-
-	l := &client.ListOptions{LabelSelector: labelSelector.AsSelector(), Namespace: deployment.Namespace}
 	var replicaSets appsv1.ReplicaSetList
-	err := c.List(ctx, &replicaSets, l)
+	err := c.List(ctx, &replicaSets, ownedBy(deployment)...)
 	if err != nil {
 		return appsv1.ReplicaSetList{}, fmt.Errorf("%w:%v", ErrFetchReplicasetFailed, err)
 	}
 
+	owned := replicaSets.Items[:0]
+	for i := range replicaSets.Items {
+		if metav1.IsControlledBy(&replicaSets.Items[i], deployment) {
+			owned = append(owned, replicaSets.Items[i])
+		}
+	}
+	replicaSets.Items = owned
+
 	return replicaSets, nil
 }
 
+// GetPodsFromReplicaSet returns the pods controlled by the replicaset.
 func GetPodsFromReplicaSet(ctx context.Context, c client.Client, rs *appsv1.ReplicaSet) (*v1.PodList, error) {
-	labelSelector := labels.Set(rs.Spec.Selector.MatchLabels)
 	pods := &v1.PodList{}
-	err := c.List(ctx, pods, &client.ListOptions{LabelSelector: labelSelector.AsSelector()})
+	err := c.List(ctx, pods, ownedBy(rs)...)
 	if err != nil {
 		return nil, fmt.Errorf("could not get pods from replica set: %w", err)
 	}
 
+	owned := pods.Items[:0]
+	for i := range pods.Items {
+		if metav1.IsControlledBy(&pods.Items[i], rs) {
+			owned = append(owned, pods.Items[i])
+		}
+	}
+	pods.Items = owned
+
 	return pods, nil
 }
 
-func IsDeploymentDisabled(deployment *appsv1.Deployment) bool {
-	enabled := deployment.Annotations[config.EnabledAnnotation]
+// ownedBy lists the objects in the owner's namespace indexed by its UID, the index is only an optimization as
+// clients without it, e.g. the fake client, ignore field selectors. Callers still check the owner reference.
+func ownedBy(owner client.Object) []client.ListOption {
+	return []client.ListOption{
+		client.InNamespace(owner.GetNamespace()),
+		client.MatchingFields{OwnerUIDField: string(owner.GetUID())},
+	}
+}
+
+// IsDisabled returns whether Babylon has been disabled for the workload, e.g. a deployment or statefulset.
+func IsDisabled(workload metav1.Object) bool {
+	enabled := workload.GetAnnotations()[config.EnabledAnnotation]
 	if strings.ToLower(enabled) == "false" {
-		log.Debugf("deployment %s has disabled Babylon, ignoring", deployment.Name)
+		log.Debugf("workload %s has disabled Babylon, ignoring", workload.GetName())
 
 		return true
 	}
@@ -121,8 +407,8 @@ func IsDeploymentDisabled(deployment *appsv1.Deployment) bool {
 	return false
 }
 
-func SafeGetLabel(deploy *appsv1.Deployment, label string) string {
-	value, ok := deploy.Labels[label]
+func SafeGetLabel(workload metav1.Object, label string) string {
+	value, ok := workload.GetLabels()[label]
 
 	if !ok {
 		value = Unknown
@@ -130,3 +416,43 @@ func SafeGetLabel(deploy *appsv1.Deployment, label string) string {
 
 	return value
 }
+
+// GetNativeSidecars returns the names of init containers with restartPolicy Always, as well as those still running
+// alongside the pod's app containers, as regular init containers must complete before the app containers are
+// started. The former includes native sidecars that crash loop before the app containers have started.
+func GetNativeSidecars(pod *v1.Pod) []string {
+	sidecars := getInitContainersWithRestartPolicy(pod)
+
+	started := false
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil || status.State.Terminated != nil ||
+			status.LastTerminationState.Terminated != nil {
+			started = true
+
+			break
+		}
+	}
+	if !started {
+		return sidecars
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.State.Terminated == nil && !slices.Contains(sidecars, status.Name) {
+			sidecars = append(sidecars, status.Name)
+		}
+	}
+
+	return sidecars
+}
+
+// getInitContainersWithRestartPolicy returns the names of init containers with restartPolicy Always.
+func getInitContainersWithRestartPolicy(pod *v1.Pod) []string {
+	var names []string
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			names = append(names, container.Name)
+		}
+	}
+
+	return names
+}
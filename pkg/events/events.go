@@ -0,0 +1,180 @@
+package events
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/strings/slices"
+)
+
+const (
+	FailedMount            = "FailedMount"
+	FailedAttachVolume     = "FailedAttachVolume"
+	FailedCreatePodSandBox = "FailedCreatePodSandBox"
+	// BackOff is emitted by the kubelet for every crash loop, which crash-loop-back-off judges by restart rate, so
+	// it is not watched unless configured.
+	BackOff = "BackOff"
+)
+
+// Signal is the aggregate of recent warning events with the same reason for a single object.
+type Signal struct {
+	Reason      string
+	Count       int32
+	LastMessage string
+	LastSeen    time.Time
+}
+
+type observedEvent struct {
+	reason   string
+	count    int32
+	message  string
+	lastSeen time.Time
+}
+
+// Watcher aggregates warning events by their involved object, so that failures which only show up as events, e.g.
+// volumes that cannot be mounted, can be correlated to pods, replicasets and deployments.
+type Watcher struct {
+	mu         sync.RWMutex
+	reasons    []string
+	maxAge     time.Duration
+	events     map[types.UID]map[types.UID]observedEvent
+	lastPruned time.Time
+	now        func() time.Time
+}
+
+func NewWatcher(reasons []string, maxAge time.Duration) *Watcher {
+	return &Watcher{
+		reasons: reasons,
+		maxAge:  maxAge,
+		events:  map[types.UID]map[types.UID]observedEvent{},
+		now:     time.Now,
+	}
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (w *Watcher) OnAdd(obj interface{}, _ bool) {
+	if event, ok := obj.(*v1.Event); ok {
+		w.Record(event)
+	}
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (w *Watcher) OnUpdate(_, newObj interface{}) {
+	w.OnAdd(newObj, false)
+}
+
+// OnDelete implements cache.ResourceEventHandler, events are forgotten once older than the max age rather than
+// when deleted, as the API server may expire them before babylon has judged the object.
+func (w *Watcher) OnDelete(interface{}) {}
+
+// Record adds a warning event with one of the watched reasons, other events are disregarded.
+func (w *Watcher) Record(event *v1.Event) {
+	if event.Type != v1.EventTypeWarning || !slices.Contains(w.reasons, event.Reason) {
+		return
+	}
+
+	lastSeen := lastSeenOf(event)
+	now := w.now()
+	if now.Sub(lastSeen) > w.maxAge {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.prune(now)
+
+	involved := event.InvolvedObject.UID
+	if w.events[involved] == nil {
+		w.events[involved] = map[types.UID]observedEvent{}
+	}
+	w.events[involved][event.UID] = observedEvent{
+		reason:   event.Reason,
+		count:    countOf(event),
+		message:  event.Message,
+		lastSeen: lastSeen,
+	}
+	log.Tracef("Event %s for %s %s: %s", event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name,
+		event.Message)
+}
+
+// Signals returns the recent signals for the object with the given UID, sorted by reason.
+func (w *Watcher) Signals(uid types.UID) []Signal {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	now := w.now()
+	byReason := map[string]*Signal{}
+	for _, event := range w.events[uid] {
+		if now.Sub(event.lastSeen) > w.maxAge {
+			continue
+		}
+
+		signal, ok := byReason[event.reason]
+		if !ok {
+			signal = &Signal{Reason: event.reason}
+			byReason[event.reason] = signal
+		}
+		signal.Count += event.count
+		if event.lastSeen.After(signal.LastSeen) || signal.LastMessage == "" {
+			signal.LastSeen = event.lastSeen
+			signal.LastMessage = event.message
+		}
+	}
+
+	signals := make([]Signal, 0, len(byReason))
+	for _, signal := range byReason {
+		signals = append(signals, *signal)
+	}
+	sort.Slice(signals, func(i, j int) bool { return signals[i].Reason < signals[j].Reason })
+
+	return signals
+}
+
+// prune forgets events older than the max age.
+func (w *Watcher) prune(now time.Time) {
+	if now.Sub(w.lastPruned) < w.maxAge {
+		return
+	}
+	w.lastPruned = now
+
+	for involved, events := range w.events {
+		for uid, event := range events {
+			if now.Sub(event.lastSeen) > w.maxAge {
+				delete(events, uid)
+			}
+		}
+		if len(events) == 0 {
+			delete(w.events, involved)
+		}
+	}
+}
+
+func lastSeenOf(event *v1.Event) time.Time {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+func countOf(event *v1.Event) int32 {
+	count := event.Count
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	return count
+}
@@ -29,15 +29,26 @@ func (h *History) historize(measurement string, tags map[string]string, fields m
 	}
 }
 
-func (h *History) HistorizeDeploymentFailing(reason, team, slackChannel, name string) {
+// HistorizeDeploymentFailing records a failing deployment, details are stored as additional fields, e.g. the
+// memory limit of a container that was OOMKilled.
+func (h *History) HistorizeDeploymentFailing(reason, message, team, slackChannel, name string,
+	details map[string]string) {
+	fields := map[string]interface{}{
+		"slack_channel": slackChannel,
+	}
+	if message != "" {
+		fields["message"] = message
+	}
+	for k, v := range details {
+		fields[k] = v
+	}
+
 	go h.historize(
 		"deployment_failing",
 		map[string]string{
 			"reason": reason, "team": team, "name": name, "cluster": h.cluster,
 		},
-		map[string]interface{}{
-			"slack_channel": slackChannel,
-		})
+		fields)
 }
 
 func (h *History) HistorizeDeploymentKilled(method, team, slackChannel, name string, armed bool) {
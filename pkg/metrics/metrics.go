@@ -11,8 +11,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
-	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -32,9 +32,17 @@ const CLEANUP DeploymentStatus = 200
 const (
 	RollbackLabel  = "rollback"
 	DownscaleLabel = "downscale"
+	SuspendLabel   = "suspend"
+	PauseLabel     = "pause"
 	defaultChannel = "#babylon-alerts"
 )
 
+const (
+	TickCompleted = "completed"
+	TickTimedOut  = "timed_out"
+	TickCancelled = "cancelled"
+)
+
 type Metrics struct {
 	DeploymentCleanup     *prometheus.CounterVec
 	RuleActivations       *prometheus.CounterVec
@@ -43,6 +51,10 @@ type Metrics struct {
 	DeploymentUpdated     *prometheus.GaugeVec
 	DeploymentGraceCutoff *prometheus.GaugeVec
 	SlackChannelMapping   *prometheus.GaugeVec
+	FailingPodRatio       *prometheus.GaugeVec
+	Leader                prometheus.Gauge
+	Ticks                 *prometheus.CounterVec
+	EvaluationDuration    *prometheus.HistogramVec
 	unleashClient         *unleash.Client
 	client                client.Client
 }
@@ -73,27 +85,44 @@ func Init(unleash *unleash.Client, c client.Client) Metrics {
 			Name: "babylon_slack_channel",
 			Help: "Latest observed slack channel by team",
 		}, []string{"deployment", "namespace", "affected_team", "slack_channel"}),
+		FailingPodRatio: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "babylon_failing_pod_ratio",
+			Help: "Ratio of failing pods in the current replicaset or statefulset revision when last judged",
+		}, []string{"deployment", "namespace", "affected_team"}),
+		Leader: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "babylon_leader",
+			Help: "Whether this replica is the leader, and judges and cleans up workloads",
+		}),
+		Ticks: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "babylon_ticks_total",
+			Help: "Runs of the main loop by outcome, either completed, timed out or cancelled",
+		}, []string{"outcome"}),
+		EvaluationDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "babylon_evaluation_duration_seconds",
+			Help:    "Time taken to judge all workloads of a kind in a run of the main loop",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+		}, []string{"kind"}),
 		unleashClient: unleash,
 		client:        c,
 	}
 }
 
-func (m Metrics) SetGraceCutoff(deployment *appsv1.Deployment, graceCutoff time.Time) {
-	team, ok := deployment.Labels["team"]
+func (m Metrics) SetGraceCutoff(deployment metav1.Object, graceCutoff time.Time) {
+	team, ok := deployment.GetLabels()["team"]
 
 	if !ok {
 		team = Unknown
 	}
 
 	m.DeploymentGraceCutoff.With(prometheus.Labels{
-		"deployment": deployment.Name, "namespace": deployment.Namespace,
+		"deployment": deployment.GetName(), "namespace": deployment.GetNamespace(),
 		"affected_team": team,
 	}).Set(float64(graceCutoff.Unix()))
 }
 
-func (m Metrics) SetDeploymentStatus(deployment *appsv1.Deployment,
+func (m Metrics) SetDeploymentStatus(deployment metav1.Object,
 	channel string, armed bool, status DeploymentStatus) {
-	team, ok := deployment.Labels["team"]
+	team, ok := deployment.GetLabels()["team"]
 
 	if !ok {
 		team = Unknown
@@ -105,33 +134,33 @@ func (m Metrics) SetDeploymentStatus(deployment *appsv1.Deployment,
 	}
 
 	m.SlackChannelMapping.With(prometheus.Labels{
-		"deployment": deployment.Name, "namespace": deployment.Namespace,
+		"deployment": deployment.GetName(), "namespace": deployment.GetNamespace(),
 		"affected_team": team, "slack_channel": channel,
 	}).SetToCurrentTime()
 
 	m.DeploymentUpdated.With(prometheus.Labels{
-		"deployment": deployment.Name, "namespace": deployment.Namespace,
+		"deployment": deployment.GetName(), "namespace": deployment.GetNamespace(),
 		"affected_team": team,
 	}).SetToCurrentTime()
 
 	m.DeploymentStatusTotal.With(prometheus.Labels{
-		"deployment": deployment.Name, "namespace": deployment.Namespace,
+		"deployment": deployment.GetName(), "namespace": deployment.GetNamespace(),
 		"affected_team": team, "dry_run": strconv.FormatBool(!armed),
 	}).Add(float64(status))
 }
 
 func (m *Metrics) IncDeploymentCleanup(
-	deployment *appsv1.Deployment,
+	deployment metav1.Object,
 	armed bool,
 	channel string,
 	reason string) {
-	team, ok := deployment.Labels["team"]
+	team, ok := deployment.GetLabels()["team"]
 	if !ok {
 		team = Unknown
 	}
 
 	m.DeploymentCleanup.With(prometheus.Labels{
-		"deployment": deployment.Name, "namespace": deployment.Namespace,
+		"deployment": deployment.GetName(), "namespace": deployment.GetNamespace(),
 		"affected_team": team, "dry_run": strconv.FormatBool(!armed), "reason": reason,
 		"slack_channel": channel,
 	}).Inc()
@@ -139,22 +168,36 @@ func (m *Metrics) IncDeploymentCleanup(
 	log.Debugf("Team %s notified in %s about rollback", team, channel)
 }
 
+// SetFailingPodRatio records the ratio of failing pods in the current revision of the workload. It is not labelled
+// by revision, as every rollout would add a series.
+func (m *Metrics) SetFailingPodRatio(workload metav1.Object, ratio float64) {
+	team, ok := workload.GetLabels()["team"]
+	if !ok {
+		team = Unknown
+	}
+
+	m.FailingPodRatio.With(prometheus.Labels{
+		"deployment": workload.GetName(), "namespace": workload.GetNamespace(),
+		"affected_team": team,
+	}).Set(ratio)
+}
+
 func (m *Metrics) IncRuleActivations(
-	pod *v1.Pod,
+	object metav1.Object,
 	reason string) {
-	team, ok := pod.Labels["team"]
+	team, ok := object.GetLabels()["team"]
 
 	if !ok {
 		team = Unknown
 	}
-	deployment, ok := pod.Labels["app"]
+	deployment, ok := object.GetLabels()["app"]
 
 	if !ok {
 		deployment = Unknown
 	}
 
 	m.RuleActivations.With(prometheus.Labels{
-		"deployment": deployment, "namespace": pod.Namespace, "affected_team": team, "reason": reason,
+		"deployment": deployment, "namespace": object.GetNamespace(), "affected_team": team, "reason": reason,
 	}).Inc()
 	log.Debugf("RuleActivationsMetric incremented by team: %s", team)
 }
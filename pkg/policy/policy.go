@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	babylon_nais_io_v1alpha1 "github.com/nais/babylon/pkg/apis/babylon.nais.io/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var ErrFetchPoliciesFailed = errors.New("failed to fetch policies")
+
+// Store holds the BabylonPolicies, reloaded as they change, and which workloads they have governed since the start of
+// the tick.
+type Store struct {
+	client   client.Client
+	mu       sync.Mutex
+	policies []babylon_nais_io_v1alpha1.BabylonPolicy
+	governed map[types.UID]map[babylon_nais_io_v1alpha1.GovernedWorkload]bool
+}
+
+func NewStore(c client.Client) *Store {
+	return &Store{client: c, governed: map[types.UID]map[babylon_nais_io_v1alpha1.GovernedWorkload]bool{}}
+}
+
+// Refresh fetches all policies, forgetting which workloads were governed previously.
+func (s *Store) Refresh(ctx context.Context) error {
+	return s.load(ctx, true)
+}
+
+// OnAdd implements cache.ResourceEventHandler, so that the reconciler judges with the current policies rather than
+// those of the last tick.
+func (s *Store) OnAdd(interface{}, bool) {
+	s.reload()
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (s *Store) OnUpdate(_, _ interface{}) {
+	s.reload()
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (s *Store) OnDelete(interface{}) {
+	s.reload()
+}
+
+func (s *Store) reload() {
+	err := s.load(context.Background(), false)
+	if err != nil {
+		log.Errorf("Could not reload policies: %v", err)
+	}
+}
+
+// load fetches all policies, and optionally forgets which workloads were governed previously.
+func (s *Store) load(ctx context.Context, forget bool) error {
+	if s == nil {
+		return nil
+	}
+
+	policies := &babylon_nais_io_v1alpha1.BabylonPolicyList{}
+	err := s.client.List(ctx, policies)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFetchPoliciesFailed, err)
+	}
+
+	// the oldest policy wins if several match the same workload
+	sort.Slice(policies.Items, func(i, j int) bool {
+		a, b := policies.Items[i], policies.Items[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+
+		return a.Name < b.Name
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies = policies.Items
+	if forget {
+		s.governed = map[types.UID]map[babylon_nais_io_v1alpha1.GovernedWorkload]bool{}
+	}
+	for i := range s.policies {
+		if _, ok := s.governed[s.policies[i].UID]; !ok {
+			s.governed[s.policies[i].UID] = map[babylon_nais_io_v1alpha1.GovernedWorkload]bool{}
+		}
+	}
+
+	return nil
+}
+
+// For returns the spec of the policy governing the workload, or nil if there is none.
+func (s *Store) For(workload client.Object) *babylon_nais_io_v1alpha1.BabylonPolicySpec {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var match *babylon_nais_io_v1alpha1.BabylonPolicy
+	for i := range s.policies {
+		policy := &s.policies[i]
+		if policy.Namespace != workload.GetNamespace() {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.Selector)
+		if err != nil {
+			log.Warnf("policy %s/%s has invalid selector: %v", policy.Namespace, policy.Name, err)
+
+			continue
+		}
+		if !selector.Matches(labels.Set(workload.GetLabels())) {
+			continue
+		}
+
+		if match != nil {
+			log.Warnf("%s is matched by both policy %s and %s, using %s",
+				workload.GetName(), match.Name, policy.Name, match.Name)
+
+			continue
+		}
+		match = policy
+	}
+
+	if match == nil {
+		return nil
+	}
+
+	s.governed[match.UID][babylon_nais_io_v1alpha1.GovernedWorkload{
+		Kind: kindOf(workload),
+		Name: workload.GetName(),
+	}] = true
+
+	return &match.Spec
+}
+
+// UpdateStatus records the workloads each policy has governed since the last refresh.
+func (s *Store) UpdateStatus(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.policies {
+		policy := &s.policies[i]
+		governed := make([]babylon_nais_io_v1alpha1.GovernedWorkload, 0, len(s.governed[policy.UID]))
+		for workload := range s.governed[policy.UID] {
+			governed = append(governed, workload)
+		}
+		sort.Slice(governed, func(i, j int) bool {
+			if governed[i].Kind != governed[j].Kind {
+				return governed[i].Kind < governed[j].Kind
+			}
+
+			return governed[i].Name < governed[j].Name
+		})
+
+		if reflect.DeepEqual(governed, policy.Status.GovernedWorkloads) ||
+			len(governed) == 0 && len(policy.Status.GovernedWorkloads) == 0 {
+			continue
+		}
+
+		patch := client.MergeFrom(policy.DeepCopy())
+		policy.Status.GovernedWorkloads = governed
+		err := s.client.Status().Patch(ctx, policy, patch)
+		if err != nil {
+			log.Errorf("Failed to update status of policy %s/%s: %v", policy.Namespace, policy.Name, err)
+		}
+	}
+}
+
+func kindOf(workload client.Object) string {
+	switch workload.(type) {
+	case *appsv1.Deployment:
+		return "Deployment"
+	case *appsv1.StatefulSet:
+		return "StatefulSet"
+	case *batchv1.CronJob:
+		return "CronJob"
+	default:
+		return workload.GetObjectKind().GroupVersionKind().Kind
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/Unleash/unleash-client-go/v3"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/nais/babylon/pkg/config"
+	"github.com/nais/babylon/pkg/events"
 	"github.com/nais/babylon/pkg/metrics"
+	"github.com/nais/babylon/pkg/policy"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -15,4 +17,6 @@ type Service struct {
 	UnleashClient *unleash.Client
 	InfluxClient  influxdb2.Client
 	History       *metrics.History
+	Events        *events.Watcher
+	Policies      *policy.Store
 }
@@ -0,0 +1,152 @@
+package statefulset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ErrFetchControllerRevisionsFailed = errors.New("failed to fetch controller revisions")
+	ErrInvalidSelector                = errors.New("invalid statefulset selector")
+	ErrDecodeRevisionFailed           = errors.New("failed to decode controller revision")
+	ErrDeleteStuckPodsFailed          = errors.New("failed to delete pods stuck on the failing revision")
+)
+
+// revisionData is the part of a StatefulSet stored in a ControllerRevision.
+type revisionData struct {
+	Spec struct {
+		Template v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+}
+
+// GetControllerRevisionsByStatefulSet returns the revisions owned by the statefulset, oldest first.
+func GetControllerRevisionsByStatefulSet(ctx context.Context,
+	c client.Client,
+	sts *appsv1.StatefulSet) ([]appsv1.ControllerRevision, error) {
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+	}
+
+	var revisionList appsv1.ControllerRevisionList
+	err = c.List(ctx, &revisionList, &client.ListOptions{LabelSelector: selector, Namespace: sts.Namespace})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchControllerRevisionsFailed, err)
+	}
+
+	var revisions []appsv1.ControllerRevision
+	for i := range revisionList.Items {
+		if metav1.IsControlledBy(&revisionList.Items[i], sts) {
+			revisions = append(revisions, revisionList.Items[i])
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+// GetPodsFromControllerRevision returns the pods of the statefulset running the given revision.
+func GetPodsFromControllerRevision(ctx context.Context,
+	c client.Client,
+	sts *appsv1.StatefulSet,
+	revision *appsv1.ControllerRevision) ([]v1.Pod, error) {
+	return getPodsByRevisionName(ctx, c, sts, revision.Name)
+}
+
+// GetStuckPods returns the pods of the statefulset that run its update revision without being ready. With the
+// OrderedReady pod management policy, the statefulset controller waits for such a pod to become ready, also after
+// the statefulset has been rolled back, so it has to be deleted to be recreated from the restored template.
+func GetStuckPods(ctx context.Context, c client.Client, sts *appsv1.StatefulSet) ([]v1.Pod, error) {
+	if sts.Spec.PodManagementPolicy == appsv1.ParallelPodManagement || sts.Status.UpdateRevision == "" {
+		return nil, nil
+	}
+
+	pods, err := getPodsByRevisionName(ctx, c, sts, sts.Status.UpdateRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	var stuck []v1.Pod
+	for i := range pods {
+		if !isReady(&pods[i]) {
+			stuck = append(stuck, pods[i])
+		}
+	}
+
+	return stuck, nil
+}
+
+func isReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func getPodsByRevisionName(ctx context.Context,
+	c client.Client,
+	sts *appsv1.StatefulSet,
+	revisionName string) ([]v1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+	}
+	revisionSelector := labels.Set{appsv1.ControllerRevisionHashLabelKey: revisionName}.AsSelector()
+	requirements, _ := revisionSelector.Requirements()
+	selector = selector.Add(requirements...)
+
+	podList := &v1.PodList{}
+	err = c.List(ctx, podList, &client.ListOptions{LabelSelector: selector, Namespace: sts.Namespace})
+	if err != nil {
+		return nil, fmt.Errorf("could not get pods from controller revision: %w", err)
+	}
+
+	var pods []v1.Pod
+	for i := range podList.Items {
+		if metav1.IsControlledBy(&podList.Items[i], sts) {
+			pods = append(pods, podList.Items[i])
+		}
+	}
+
+	return pods, nil
+}
+
+// GetRollbackRevision returns the revision the statefulset is rolling out from, or nil if it is not in the
+// middle of a rollout.
+func GetRollbackRevision(sts *appsv1.StatefulSet, revisions []appsv1.ControllerRevision) *appsv1.ControllerRevision {
+	if sts.Status.CurrentRevision == "" || sts.Status.CurrentRevision == sts.Status.UpdateRevision {
+		return nil
+	}
+
+	for i := range revisions {
+		if revisions[i].Name == sts.Status.CurrentRevision {
+			return &revisions[i]
+		}
+	}
+
+	return nil
+}
+
+// GetRevisionTemplate decodes the pod template stored in a controller revision.
+func GetRevisionTemplate(revision *appsv1.ControllerRevision) (*v1.PodTemplateSpec, error) {
+	var data revisionData
+	if err := json.Unmarshal(revision.Data.Raw, &data); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrDecodeRevisionFailed, revision.Name, err)
+	}
+
+	return &data.Spec.Template, nil
+}